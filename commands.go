@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/anomaly"
+	"github.com/ajeetraina/genai-app-demo/pkg/dashboard"
+	"github.com/ajeetraina/genai-app-demo/pkg/fakellm"
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/ajeetraina/genai-app-demo/pkg/rules"
+	"gopkg.in/yaml.v3"
+)
+
+// commands maps subcommand names to their entry points. Running the binary
+// without a subcommand starts the server.
+var commands = map[string]func(args []string) error{
+	"fake-llm":  runFakeLLM,
+	"rules":     runRules,
+	"dashboard": runDashboard,
+}
+
+// runCommand runs the named subcommand
+func runCommand(name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return command(args)
+}
+
+// runFakeLLM serves the deterministic fake OpenAI-compatible backend
+func runFakeLLM(args []string) error {
+	cfg := fakellm.DefaultConfig()
+
+	fs := flag.NewFlagSet("fake-llm", flag.ExitOnError)
+	addr := fs.String("addr", ":12434", "Address to listen on")
+	script := fs.String("script", "", "JSON file with model, rules, responses and the other settings")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "Model name reported in responses")
+	fs.DurationVar(&cfg.TimeToFirstToken, "ttft", cfg.TimeToFirstToken, "Delay before the first token")
+	fs.Float64Var(&cfg.TokensPerSecond, "tps", cfg.TokensPerSecond, "Tokens per second after the first token (0 for no delay)")
+	fs.Float64Var(&cfg.ErrorRate, "error-rate", cfg.ErrorRate, "Fraction of requests answered with an error")
+	fs.IntVar(&cfg.ErrorStatus, "error-status", cfg.ErrorStatus, "Status code for injected errors")
+	fs.Float64Var(&cfg.StreamErrorRate, "stream-error-rate", cfg.StreamErrorRate, "Fraction of streams cut halfway")
+	fs.BoolVar(&cfg.IncludeUsage, "usage", cfg.IncludeUsage, "Always report token usage in streams")
+	fs.IntVar(&cfg.EmbeddingDimensions, "dimensions", cfg.EmbeddingDimensions, "Embedding vector dimensions")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "Seed for error injection")
+	fs.Parse(args)
+
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			return fmt.Errorf("failed to read script: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("failed to parse script: %w", err)
+		}
+	}
+
+	server := &http.Server{
+		Addr:        *addr,
+		Handler:     fakellm.New(cfg),
+		ReadTimeout: 30 * time.Second,
+	}
+
+	log.Printf("Starting fake LLM on %s (model %s)", *addr, cfg.Model)
+	return server.ListenAndServe()
+}
+
+// runRules writes Prometheus recording and alerting rules for the metrics
+// registered by the server
+func runRules(args []string) error {
+	opts := rules.DefaultOptions()
+
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	output := fs.String("o", "", "File to write the rules to (default stdout)")
+	sloFile := fs.String("slo-config", os.Getenv("SLO_CONFIG_FILE"), "JSON file with service level objectives")
+	fs.StringVar(&opts.Job, "job", opts.Job, "Prometheus scrape job of the server")
+	fs.StringVar(&opts.RateWindow, "window", opts.RateWindow, "Range of rate() in recording rules")
+	fs.Float64Var(&opts.ErrorRatio, "error-ratio", opts.ErrorRatio, "Fraction of failed chats that raises an alert")
+	fs.BoolVar(&opts.ExcludeInjected, "exclude-injected", opts.ExcludeInjected, "Leave injected faults out of the chat error ratio")
+	fs.Float64Var(&opts.TTFTRegression, "ttft-regression", opts.TTFTRegression, "Increase of the p90 time to first token over a day that raises an alert")
+	fs.IntVar(&opts.MaxActiveRequests, "max-active", opts.MaxActiveRequests, "Requests in flight considered saturated")
+	fs.Float64Var(&opts.AnomalyScore, "anomaly-score", opts.AnomalyScore, "Anomaly score that raises an alert")
+	fs.Parse(args)
+
+	sloConfig, err := loadSLOConfig(*sloFile)
+	if err != nil {
+		return err
+	}
+	opts.Objectives = sloConfig.Objectives
+
+	inventory := metrics.NewInventory()
+	registerMetrics(inventory, sloConfig, anomaly.DefaultConfig())
+	file, err := rules.Generate(inventory, opts)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by `genai-app rules`, do not edit.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return fmt.Errorf("failed to encode rules: %w", err)
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(*output, buf.Bytes(), 0o644)
+}
+
+// runDashboard writes the Grafana dashboard for the metrics registered by the server
+func runDashboard(args []string) error {
+	opts := dashboard.DefaultOptions()
+
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	output := fs.String("o", "", "File to write the dashboard to (default stdout)")
+	sloFile := fs.String("slo-config", os.Getenv("SLO_CONFIG_FILE"), "JSON file with service level objectives")
+	fs.StringVar(&opts.UID, "uid", opts.UID, "Dashboard UID")
+	fs.StringVar(&opts.Title, "title", opts.Title, "Dashboard title")
+	fs.Parse(args)
+
+	sloConfig, err := loadSLOConfig(*sloFile)
+	if err != nil {
+		return err
+	}
+	opts.Objectives = sloConfig.Objectives
+
+	inventory := metrics.NewInventory()
+	registerMetrics(inventory, sloConfig, anomaly.DefaultConfig())
+	data, err := json.MarshalIndent(dashboard.Build(inventory, opts), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dashboard: %w", err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0o644)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/openai/openai-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+)
+
+// EmbeddingRequest is the simplified request accepted by /embeddings
+type EmbeddingRequest struct {
+	Input json.RawMessage `json:"input"`
+	Model string          `json:"model,omitempty"`
+}
+
+// EmbeddingResponse is the simplified response returned by /embeddings
+type EmbeddingResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Dimensions int         `json:"dimensions"`
+	Tokens     int64       `json:"tokens"`
+}
+
+// parseEmbeddingInput accepts either a single string or an array of strings
+func parseEmbeddingInput(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		if single == "" {
+			return nil, errors.New("input must not be empty")
+		}
+		return []string{single}, nil
+	}
+
+	var batch []string
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		return nil, errors.New("input must be a string or an array of strings")
+	}
+	if len(batch) == 0 {
+		return nil, errors.New("input must not be empty")
+	}
+	return batch, nil
+}
+
+// embeddingOperation describes an embedding call for the GenAI semantic convention metrics
+func embeddingOperation(model, responseModel string, inputTokens int, duration time.Duration, errorType string) metrics.GenAIOperation {
+	return metrics.GenAIOperation{
+		Operation:     tracing.GenAIOperationEmbeddings,
+		System:        tracing.GenAISystem,
+		RequestModel:  model,
+		ResponseModel: responseModel,
+		InputTokens:   inputTokens,
+		Duration:      duration,
+		ErrorType:     errorType,
+	}
+}
+
+// embeddingErrorStatus maps an upstream error to the status code returned to the caller
+func embeddingErrorStatus(err error) int {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 {
+		return apiErr.StatusCode
+	}
+	return http.StatusBadGateway
+}
+
+// handleEmbeddings handles the simplified embeddings endpoint
+func handleEmbeddings(client *openai.Client, rec *metrics.Recorder, defaultModel string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, traceparent, tracestate, baggage")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req EmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			rec.RecordError(r.URL.Path, metrics.ErrorClientInput)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		inputs, err := parseEmbeddingInput(req.Input)
+		if err != nil {
+			rec.RecordError(r.URL.Path, metrics.ErrorClientInput)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		model := req.Model
+		if model == "" {
+			model = defaultModel
+		}
+
+		ctx, span := tracing.StartGenAISpan(r.Context(), tracing.GenAIOperationEmbeddings, model)
+		defer span.End()
+		span.SetAttributes(attribute.Int("embedding.batch_size", len(inputs)))
+
+		start := time.Now()
+		resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+			Input: openai.F[openai.EmbeddingNewParamsInputUnion](openai.EmbeddingNewParamsInputArrayOfStrings(inputs)),
+			Model: openai.F(openai.EmbeddingModel(model)),
+		})
+		duration := time.Since(start)
+
+		if err != nil {
+			log.Printf("Error creating embeddings: %v", err)
+			errorType := classifyError(ctx, err)
+			rec.RecordError(r.URL.Path, errorType)
+			rec.RecordGenAIOperation(embeddingOperation(model, "", 0, duration, errorType))
+			tracing.RecordError(ctx, err, "Embedding request failed")
+			http.Error(w, "Embedding request failed", embeddingErrorStatus(err))
+			return
+		}
+
+		embeddings := make([][]float64, 0, len(resp.Data))
+		for _, data := range resp.Data {
+			embeddings = append(embeddings, data.Embedding)
+		}
+
+		dimensions := 0
+		if len(embeddings) > 0 {
+			dimensions = len(embeddings[0])
+		}
+
+		rec.RecordEmbedding(model, len(inputs), dimensions, duration)
+		rec.RecordGenAIOperation(embeddingOperation(model, resp.Model, int(resp.Usage.PromptTokens), duration, ""))
+		span.SetAttributes(attribute.Int("embedding.dimensions", dimensions))
+		span.SetAttributes(tracing.GenAIResponseAttributes("", resp.Model, nil)...)
+		span.SetAttributes(semconv.GenAIUsageInputTokens(int(resp.Usage.PromptTokens)))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EmbeddingResponse{
+			Model:      model,
+			Embeddings: embeddings,
+			Dimensions: dimensions,
+			Tokens:     resp.Usage.PromptTokens,
+		})
+	}
+}
+
+// withDefaultModel sets the model of an embedding request body that has none,
+// so the backend serves the model the metrics are labelled with
+func withDefaultModel(body []byte, model string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	fields["model"] = encoded
+	return json.Marshal(fields)
+}
+
+// writeUpstreamError passes the status and body of a backend error response
+// through to the caller. Errors without a response are reported as a bad gateway.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.Response == nil || apiErr.StatusCode < 400 {
+		http.Error(w, "Embedding request failed", http.StatusBadGateway)
+		return
+	}
+	body, readErr := io.ReadAll(apiErr.Response.Body)
+	if readErr != nil {
+		http.Error(w, "Embedding request failed", apiErr.StatusCode)
+		return
+	}
+	if contentType := apiErr.Response.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(apiErr.StatusCode)
+	w.Write(body)
+}
+
+// handleEmbeddingsPassthrough forwards OpenAI-compatible embedding requests to
+// the backend, adding the default model when the request has none. Backend
+// errors are returned as-is.
+func handleEmbeddingsPassthrough(client *openai.Client, rec *metrics.Recorder, defaultModel string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, traceparent, tracestate, baggage")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			rec.RecordError(r.URL.Path, metrics.ErrorClientInput)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Only the fields needed for labels are decoded, the body is forwarded as-is
+		// apart from the default model
+		var req EmbeddingRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			rec.RecordError(r.URL.Path, metrics.ErrorClientInput)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		model := req.Model
+		if model == "" {
+			model = defaultModel
+			if body, err = withDefaultModel(body, model); err != nil {
+				rec.RecordError(r.URL.Path, metrics.ErrorClientInput)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		batchSize := 1
+		var batch []json.RawMessage
+		if err := json.Unmarshal(req.Input, &batch); err == nil {
+			batchSize = len(batch)
+		}
+
+		ctx, span := tracing.StartGenAISpan(r.Context(), tracing.GenAIOperationEmbeddings, model)
+		defer span.End()
+		span.SetAttributes(
+			attribute.Int("embedding.batch_size", batchSize),
+			attribute.Bool("embedding.passthrough", true),
+		)
+
+		start := time.Now()
+		var raw json.RawMessage
+		err = client.Post(ctx, "embeddings", body, &raw)
+		duration := time.Since(start)
+
+		if err != nil {
+			log.Printf("Error forwarding embeddings request: %v", err)
+			errorType := classifyError(ctx, err)
+			rec.RecordError(r.URL.Path, errorType)
+			rec.RecordGenAIOperation(embeddingOperation(model, "", 0, duration, errorType))
+			tracing.RecordError(ctx, err, "Embedding passthrough failed")
+			writeUpstreamError(w, err)
+			return
+		}
+
+		dimensions := 0
+		var resp openai.CreateEmbeddingResponse
+		if err := json.Unmarshal(raw, &resp); err == nil && len(resp.Data) > 0 {
+			dimensions = len(resp.Data[0].Embedding)
+		}
+
+		rec.RecordEmbedding(model, batchSize, dimensions, duration)
+		rec.RecordGenAIOperation(embeddingOperation(model, resp.Model, int(resp.Usage.PromptTokens), duration, ""))
+		span.SetAttributes(attribute.Int("embedding.dimensions", dimensions))
+		span.SetAttributes(tracing.GenAIResponseAttributes("", resp.Model, nil)...)
+		span.SetAttributes(semconv.GenAIUsageInputTokens(int(resp.Usage.PromptTokens)))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(raw)
+	}
+}
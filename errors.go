@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/openai/openai-go"
+)
+
+// classifyError maps a failed model backend call to one of the error types in pkg/metrics.
+// ctx is the request context, used to tell client disconnects from backend failures.
+func classifyError(ctx context.Context, err error) string {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return metrics.ErrorStreamInterrupted
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return metrics.ErrorRateLimited
+		case apiErr.StatusCode == http.StatusRequestTimeout:
+			return metrics.ErrorUpstreamTimeout
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return metrics.ErrorUpstream5xx
+		}
+		return metrics.ErrorInternal
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return metrics.ErrorUpstreamTimeout
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return metrics.ErrorStreamInterrupted
+	}
+	return metrics.ErrorInternal
+}
+
+// errorStatus returns the status code reported to the client for an error type
+func errorStatus(errorType string) int {
+	switch errorType {
+	case metrics.ErrorClientInput:
+		return http.StatusBadRequest
+	case metrics.ErrorRateLimited:
+		return http.StatusTooManyRequests
+	case metrics.ErrorUpstreamTimeout:
+		return http.StatusGatewayTimeout
+	case metrics.ErrorUpstream5xx:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
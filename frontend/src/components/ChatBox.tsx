@@ -4,6 +4,17 @@ import { MessageList } from './MessageList';
 import { MessageInput } from './MessageInput';
 import { SimplifiedMetrics } from './SimplifiedMetrics';
 import { ModelInfoCard } from './ModelInfoCard';
+import { recordRumEvent, trackRumStream } from '../rum';
+
+// getSessionId identifies this browser tab in the backend message analytics
+const getSessionId = (): string => {
+  let sessionId = sessionStorage.getItem('sessionId');
+  if (!sessionId) {
+    sessionId = crypto.randomUUID();
+    sessionStorage.setItem('sessionId', sessionId);
+  }
+  return sessionId;
+};
 
 export default function ChatBox() {
   const [input, setInput] = useState('');
@@ -58,7 +69,8 @@ export default function ChatBox() {
 
     try {
       // Record message metrics
-      const messageId = Date.now().toString();
+      // Sent with the chat request so the server can correlate the metrics logged below
+      const messageId = crypto.randomUUID();
       const requestStartTime = performance.now();
       const tokensIn = estimateTokenCount(currentInput);
       
@@ -90,7 +102,7 @@ export default function ChatBox() {
       const response = await fetch('http://localhost:8080/chat', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ message: currentInput, messages: messages }),
+        body: JSON.stringify({ message: currentInput, messages: messages, message_id: messageId, session_id: getSessionId() }),
       });
 
       if (response.status !== 200) {
@@ -114,6 +126,8 @@ export default function ChatBox() {
     const decoder = new TextDecoder();
     let done = false;
     let hasReceivedFirstToken = false;
+    const traceId = response.headers.get('X-Trace-Id');
+    trackRumStream(traceId, requestStartTime);
 
     const aiMessageId = Date.now().toString();
     const aiMessage: Message = {
@@ -128,7 +142,14 @@ export default function ChatBox() {
 
     let tokenCount = 0;
     while (!done && reader) {
-      const { value, done: doneReading } = await reader.read();
+      let result: ReadableStreamReadResult<Uint8Array>;
+      try {
+        result = await reader.read();
+      } catch (e) {
+        recordRumEvent(traceId, 'aborted', requestStartTime);
+        throw e;
+      }
+      const { value, done: doneReading } = result;
       done = doneReading;
       const chunk = decoder.decode(value, { stream: true });
       
@@ -138,6 +159,8 @@ export default function ChatBox() {
       if (!hasReceivedFirstToken && chunk.length > 0) {
         hasReceivedFirstToken = true;
         const firstTokenTime = performance.now();
+        // The first token is on screen once React has committed it and the browser painted
+        requestAnimationFrame(() => recordRumEvent(traceId, 'first_token_rendered', requestStartTime));
         setMessageMetrics(prev => {
           const metric = prev[messageId];
           if (metric) {
@@ -172,6 +195,7 @@ export default function ChatBox() {
 
     // Record final metrics after response is complete
     const responseEndTime = performance.now();
+    recordRumEvent(traceId, 'stream_complete', requestStartTime);
     setMessageMetrics(prev => {
       const metric = prev[messageId];
       if (metric) {
@@ -0,0 +1,48 @@
+// Real-User-Monitoring beacons for chat requests. Events are keyed by the trace
+// ID the backend returns in X-Trace-Id and sent in batches to /rum with
+// navigator.sendBeacon, so they still arrive when the page is being closed.
+
+type RumEventType = 'first_token_rendered' | 'stream_complete' | 'aborted';
+
+interface Beacon {
+  trace_id: string;
+  type: RumEventType;
+  elapsed_ms: number;
+}
+
+const RUM_URL = 'http://localhost:8080/rum';
+const MAX_BATCH = 20;
+
+let queue: Beacon[] = [];
+
+// Streams that have not completed yet, reported as aborted if the page goes away
+const openStreams = new Map<string, number>();
+
+export const flushRum = () => {
+  while (queue.length > 0) {
+    const batch = queue.slice(0, MAX_BATCH);
+    queue = queue.slice(MAX_BATCH);
+    const body = JSON.stringify({ beacons: batch });
+    if (!navigator.sendBeacon?.(RUM_URL, body)) {
+      fetch(RUM_URL, { method: 'POST', body, keepalive: true }).catch(() => {});
+    }
+  }
+};
+
+// trackRumStream marks a response as streaming until it completes or aborts
+export const trackRumStream = (traceId: string | null, startTime: number) => {
+  if (traceId) openStreams.set(traceId, startTime);
+};
+
+export const recordRumEvent = (traceId: string | null, type: RumEventType, startTime: number) => {
+  if (!traceId) return; // Tracing is disabled on the backend
+  queue.push({ trace_id: traceId, type, elapsed_ms: performance.now() - startTime });
+  if (type !== 'first_token_rendered') openStreams.delete(traceId);
+  // Batch events of a running stream and send them when it ends
+  if (!openStreams.has(traceId) || queue.length >= MAX_BATCH) flushRum();
+};
+
+window.addEventListener('pagehide', () => {
+  openStreams.forEach((startTime, traceId) => recordRumEvent(traceId, 'aborted', startTime));
+  flushRum();
+});
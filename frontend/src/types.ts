@@ -19,6 +19,15 @@ export interface LlamaCppMetrics {
   modelType: string;
 }
 
+// Latency percentiles in seconds, estimated from histogram buckets
+export interface LatencyStats {
+  count: number;
+  average: number;
+  p50: number;
+  p90: number;
+  p99: number;
+}
+
 // Metrics-related types
 export interface MetricsData {
   totalRequests: number;
@@ -27,7 +36,30 @@ export interface MetricsData {
   tokensProcessed?: number; // New field for input tokens
   activeUsers: number;
   errorRate: number;
+  totalCost?: number; // Estimated cost from the backend pricing table
+  totalEnergyJoules?: number; // Estimated energy from the backend pricing table
   llamaCppMetrics?: LlamaCppMetrics; // Added llama.cpp metrics
+  responseTime?: LatencyStats;
+  timeToFirstToken?: LatencyStats;
+  interTokenLatency?: LatencyStats;
+  responseTimeByModel?: Record<string, LatencyStats>;
+  timeToFirstTokenByModel?: Record<string, LatencyStats>;
+  responseTimeByEndpoint?: Record<string, LatencyStats>;
+  window?: WindowSummary; // Present when requested with ?window=
+}
+
+// Aggregates of recent chat requests returned by /metrics/summary?window=
+export interface WindowSummary {
+  window: string;
+  requests: number;
+  requestRate: number;
+  errors: number;
+  errorRate: number;
+  tokensIn: number;
+  tokensOut: number;
+  tokensPerSecond: number;
+  responseTime: LatencyStats;
+  timeToFirstToken: LatencyStats;
 }
 
 export interface MessageMetrics {
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,20 +14,25 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ajeetraina/genai-app-demo/pkg/analytics"
+	"github.com/ajeetraina/genai-app-demo/pkg/anomaly"
+	"github.com/ajeetraina/genai-app-demo/pkg/faults"
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
 	"github.com/ajeetraina/genai-app-demo/pkg/middleware"
+	"github.com/ajeetraina/genai-app-demo/pkg/pricing"
+	"github.com/ajeetraina/genai-app-demo/pkg/slo"
+	"github.com/ajeetraina/genai-app-demo/pkg/telemetry"
 	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	dto "github.com/prometheus/client_model/go"
+	"github.com/ajeetraina/genai-app-demo/pkg/upstream"
+	"github.com/google/uuid"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Create a custom registry for metrics
-var registry = prometheus.NewRegistry()
-var promautoFactory = promauto.With(registry)
-
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -36,318 +42,186 @@ type ChatRequest struct {
 	Messages []Message `json:"messages"`
 	Message  string    `json:"message"`
 	Format   string    `json:"format,omitempty"` // Optional format parameter
+	// MessageID correlates the request with the metrics the frontend reports for it
+	MessageID string `json:"message_id,omitempty"`
+	// SessionID groups the messages of one browser session in the analytics store
+	SessionID string `json:"session_id,omitempty"`
 }
 
-type MetricLog struct {
-	MessageID      string  `json:"message_id"`
-	TokensIn       int     `json:"tokens_in"`
-	TokensOut      int     `json:"tokens_out"`
-	ResponseTimeMs float64 `json:"response_time_ms"`
-	FirstTokenMs   float64 `json:"time_to_first_token_ms"`
-}
-
-type ErrorLog struct {
-	ErrorType   string `json:"error_type"`
-	StatusCode  int    `json:"status_code"`
-	InputLength int    `json:"input_length"`
-	Timestamp   string `json:"timestamp"`
-}
-
-// LlamaCppMetrics represents the metrics specific to llama.cpp
-type LlamaCppMetrics struct {
-	ContextSize     int     `json:"context_size"`
-	PromptEvalTime  float64 `json:"prompt_eval_time_ms"`
-	TokensPerSecond float64 `json:"tokens_per_second"`
-	MemoryPerToken  float64 `json:"memory_per_token_bytes"`
-	ThreadsUsed     int     `json:"threads_used"`
-	BatchSize       int     `json:"batch_size"`
-	ModelType       string  `json:"model_type"`
+// ChatSummaryEvent is sent as the final event of a chat stream when the client
+// asks for Server-Sent Events framing
+type ChatSummaryEvent struct {
+	Model          string           `json:"model"`
+	TokensIn       int              `json:"tokens_in"`
+	TokensOut      int              `json:"tokens_out"`
+	FirstTokenMs   float64          `json:"time_to_first_token_ms"`
+	ResponseTimeMs float64          `json:"response_time_ms"`
+	Cost           pricing.Estimate `json:"cost"`
+
+	// Inter-token latency of the stream
+	InterTokenMeanMs float64 `json:"inter_token_mean_ms"`
+	InterTokenP95Ms  float64 `json:"inter_token_p95_ms"`
+	MaxTokenGapMs    float64 `json:"max_token_gap_ms"`
 }
 
-// MetricsSummary represents the summary metrics sent to the frontend
-type MetricsSummary struct {
-	TotalRequests      float64  `json:"totalRequests"`
-	AverageResponseTime float64 `json:"averageResponseTime"`
-	TokensGenerated    float64  `json:"tokensGenerated"`
-	TokensProcessed    float64  `json:"tokensProcessed"`
-	ActiveUsers        float64  `json:"activeUsers"`
-	ErrorRate          float64  `json:"errorRate"`
-	LlamaCppMetrics    *LlamaCppMetrics `json:"llamaCppMetrics,omitempty"`
-}
-
-// Define metrics
-var (
-	requestCounter = promautoFactory.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "genai_app_http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-	
-	requestDuration = promautoFactory.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "genai_app_http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
-	
-	chatTokensCounter = promautoFactory.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "genai_app_chat_tokens_total",
-			Help: "Total number of tokens processed in chat",
-		},
-		[]string{"direction", "model"},
-	)
-	
-	modelLatency = promautoFactory.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "genai_app_model_latency_seconds",
-			Help:    "Model response time in seconds",
-			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 20, 30, 60},
-		},
-		[]string{"model", "operation"},
-	)
-	
-	activeRequests = promautoFactory.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "genai_app_active_requests",
-			Help: "Number of currently active requests",
-		},
-	)
-
-	// Add error counter metric
-	errorCounter = promautoFactory.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "genai_app_errors_total",
-			Help: "Total number of errors",
-		},
-		[]string{"type"},
-	)
+func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
 
-	// Add first token latency metric
-	firstTokenLatency = promautoFactory.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "genai_app_first_token_latency_seconds",
-			Help:    "Time to first token in seconds",
-			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5},
-		},
-		[]string{"model"},
-	)
+	log.Println("Starting GenAI App with observability")
 
-	// LlamaCpp metrics
-	llamacppContextSize = promautoFactory.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "genai_app_llamacpp_context_size",
-			Help: "Context window size in tokens for llama.cpp models",
-		},
-		[]string{"model"},
-	)
+	// Get configuration from environment
+	baseURL := os.Getenv("BASE_URL")
+	model := os.Getenv("MODEL")
+	apiKey := os.Getenv("API_KEY")
+	embeddingModel := getEnvOrDefault("EMBEDDING_MODEL", model)
 
-	llamacppPromptEvalTime = promautoFactory.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "genai_app_llamacpp_prompt_eval_seconds",
-			Help:    "Time spent evaluating the prompt in seconds",
-			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10},
-		},
-		[]string{"model"},
-	)
+	// Gaps between streamed tokens above this threshold are reported as stalls
+	stallThreshold, err := time.ParseDuration(getEnvOrDefault("STREAM_STALL_THRESHOLD", "1s"))
+	if err != nil {
+		log.Printf("Invalid STREAM_STALL_THRESHOLD, using 1s: %v", err)
+		stallThreshold = time.Second
+	}
 
-	llamacppTokensPerSecond = promautoFactory.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "genai_app_llamacpp_tokens_per_second",
-			Help: "Tokens generated per second",
-		},
-		[]string{"model"},
-	)
+	// Load the optional pricing table used for cost and energy estimates
+	var prices *pricing.Table
+	if pricingFile := os.Getenv("PRICING_FILE"); pricingFile != "" {
+		table, err := pricing.Load(pricingFile)
+		if err != nil {
+			log.Printf("Failed to load pricing table: %v", err)
+		} else {
+			prices = table
+			log.Printf("Loaded pricing for %d models from %s", len(table.Models), pricingFile)
+		}
+	}
 
-	llamacppMemoryPerToken = promautoFactory.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "genai_app_llamacpp_memory_per_token_bytes",
-			Help: "Memory usage per token in bytes",
-		},
-		[]string{"model"},
-	)
+	// Sampling, exporters and the OTLP connection come from TRACING_CONFIG_FILE,
+	// overridden by the environment. OTLP metrics use the same connection with
+	// their own endpoint.
+	tracingConfig, tracingConfigErr := loadTracingConfig(os.Getenv("TRACING_CONFIG_FILE"))
 
-	llamacppThreadsUsed = promautoFactory.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "genai_app_llamacpp_threads_used",
-			Help: "Number of threads used for inference",
-		},
-		[]string{"model"},
-	)
+	// Tracing setup
+	tracingEnabled, _ := strconv.ParseBool(getEnvOrDefault("TRACING_ENABLED", "false"))
+	var tracingCleanup func()
 
-	llamacppBatchSize = promautoFactory.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "genai_app_llamacpp_batch_size",
-			Help: "Batch size used for inference",
-		},
-		[]string{"model"},
-	)
-)
+	if tracingEnabled {
+		err := tracingConfigErr
+		log.Printf("Setting up tracing with %s exporter (endpoint %s, sample ratio %v)",
+			tracingConfig.Exporter, tracingConfig.Endpoint, tracingConfig.SampleRatio)
 
-// Helper function to get counter value
-func getCounterValue(counter *prometheus.CounterVec, labelValues ...string) float64 {
-	// Use 0 as the default value
-	value := 0.0
-	
-	// If labels are provided, try to get a specific counter
-	if len(labelValues) > 0 {
-		c, err := counter.GetMetricWithLabelValues(labelValues...)
+		var cleanup func()
 		if err == nil {
-			metric := &dto.Metric{}
-			if err := c.(prometheus.Metric).Write(metric); err == nil && metric.Counter != nil {
-				value = metric.Counter.GetValue()
-			}
+			cleanup, err = tracing.SetupTracing("genai-app", tracingConfig)
 		}
-		return value
-	}
-	
-	// Otherwise, sum all counters
-	metrics := make(chan prometheus.Metric, 100)
-	counter.Collect(metrics)
-	close(metrics)
-	
-	for metric := range metrics {
-		m := &dto.Metric{}
-		if err := metric.Write(m); err == nil && m.Counter != nil {
-			value += m.Counter.GetValue()
+		if err != nil {
+			log.Printf("Failed to set up tracing: %v", err)
+		} else {
+			tracingCleanup = cleanup
+			defer tracingCleanup()
+			log.Println("Tracing initialized successfully")
 		}
 	}
-	
-	return value
-}
 
-// Helper function to get gauge value
-func getGaugeValue(gauge prometheus.Gauge) float64 {
-	value := 0.0
-	metric := &dto.Metric{}
-	if err := gauge.Write(metric); err == nil && metric.Gauge != nil {
-		value = metric.Gauge.GetValue()
+	// Service level objectives come from SLO_CONFIG_FILE
+	sloConfig, err := loadSLOConfig(os.Getenv("SLO_CONFIG_FILE"))
+	if err != nil {
+		log.Printf("Failed to load SLO config, using the defaults: %v", err)
 	}
-	return value
-}
-
-// Helper function to get gauge value with labels
-func getGaugeValueWithLabels(gauge *prometheus.GaugeVec, labelValues ...string) float64 {
-	if len(labelValues) == 0 {
-		return 0.0
+	log.Printf("Tracking %d service level objectives", len(sloConfig.Objectives))
+
+	// Chat outcomes are compared with rolling per-model baselines
+	anomalyConfig := anomaly.DefaultConfig()
+	if interval, err := time.ParseDuration(getEnvOrDefault("ANOMALY_INTERVAL", "1m")); err == nil && interval > 0 {
+		anomalyConfig.Interval = interval
+	} else {
+		log.Printf("Invalid ANOMALY_INTERVAL, using %s", anomalyConfig.Interval)
 	}
-	
-	g, err := gauge.GetMetricWithLabelValues(labelValues...)
-	if err != nil {
-		return 0.0
+	if threshold, err := strconv.ParseFloat(getEnvOrDefault("ANOMALY_THRESHOLD", "3"), 64); err == nil && threshold > 0 {
+		anomalyConfig.Threshold = threshold
+	} else {
+		log.Printf("Invalid ANOMALY_THRESHOLD, using %g", anomalyConfig.Threshold)
 	}
-	
-	metric := &dto.Metric{}
-	if err := g.(prometheus.Metric).Write(metric); err == nil && metric.Gauge != nil {
-		return metric.Gauge.GetValue()
+	if seasonal, err := strconv.ParseBool(getEnvOrDefault("ANOMALY_SEASONAL", "true")); err == nil {
+		anomalyConfig.Seasonal = seasonal
+	} else {
+		log.Printf("Invalid ANOMALY_SEASONAL, using %t: %v", anomalyConfig.Seasonal, err)
 	}
-	
-	return 0.0
-}
-
-// Helper function to get histogram value with labels
-func getHistogramValueWithLabels(histogram *prometheus.HistogramVec, labelValues ...string) float64 {
-    if len(labelValues) == 0 {
-        return 0.0
-    }
-    
-    h, err := histogram.GetMetricWithLabelValues(labelValues...)
-    if err != nil {
-        return 0.0
-    }
-    
-    // For histograms, we can get the sum and count to calculate an average
-    metric := &dto.Metric{}
-    if err := h.(prometheus.Metric).Write(metric); err == nil && metric.Histogram != nil {
-        if metric.Histogram.GetSampleCount() > 0 {
-            return metric.Histogram.GetSampleSum() / float64(metric.Histogram.GetSampleCount())
-        }
-    }
-    
-    return 0.0
-}
-
-// Helper function to calculate error rate
-func calculateErrorRate() float64 {
-	totalErrors := getCounterValue(errorCounter)
-	totalRequests := getCounterValue(requestCounter)
-	
-	if totalRequests == 0 {
-		return 0.0
+	anomalyConfig.WebhookURL = os.Getenv("ANOMALY_WEBHOOK_URL")
+
+	// All application metrics are registered with a dedicated registry
+	registry := prometheus.NewRegistry()
+	rec, slos, detector := registerMetrics(registry, sloConfig, anomalyConfig)
+	detector.Start()
+	defer detector.Close()
+
+	// Metrics labelled with request-supplied values are capped to this many series each
+	if limit, err := strconv.Atoi(getEnvOrDefault("METRICS_MAX_SERIES", strconv.Itoa(metrics.DefaultSeriesLimit))); err == nil {
+		rec.Labels.SetLimit(limit)
+	} else {
+		log.Printf("Invalid METRICS_MAX_SERIES, using %d: %v", metrics.DefaultSeriesLimit, err)
 	}
-	
-	return totalErrors / totalRequests
-}
 
-// Helper function to calculate average response time
-func getAverageResponseTime(histogram *prometheus.HistogramVec) float64 {
-	// This is a simplification - in a real app you'd calculate this from histogram buckets
-	// For now, we'll use a fixed value
-	return 0.5 // 500ms average response time
-}
-
-// Helper function to get LlamaCpp metrics for the current model
-func getLlamaCppMetrics(model string) *LlamaCppMetrics {
-	// Check if any llama.cpp metrics exist for this model
-	contextSize := int(getGaugeValueWithLabels(llamacppContextSize, model))
-	if contextSize == 0 {
-		return nil // No llama.cpp metrics available
+	// Metrics are scraped by Prometheus, pushed to an OTel collector over OTLP, or both
+	metricsExporter, err := metrics.ParseExporter(os.Getenv("METRICS_EXPORTER"))
+	if err != nil {
+		log.Printf("%v, using prometheus", err)
+		metricsExporter = metrics.ExporterPrometheus
 	}
-	
-	// Collect all metrics
-	return &LlamaCppMetrics{
-		ContextSize:     contextSize,
-		PromptEvalTime:  getHistogramValueWithLabels(llamacppPromptEvalTime, model) * 1000, // Convert to ms
-		TokensPerSecond: getGaugeValueWithLabels(llamacppTokensPerSecond, model),
-		MemoryPerToken:  getGaugeValueWithLabels(llamacppMemoryPerToken, model),
-		ThreadsUsed:     int(getGaugeValueWithLabels(llamacppThreadsUsed, model)),
-		BatchSize:       int(getGaugeValueWithLabels(llamacppBatchSize, model)),
-		ModelType:       "llama.cpp",
+	// Trace backends such as Jaeger do not accept metrics, so they are only
+	// pushed to a receiver named explicitly, over the connection of the traces
+	metricsEndpoint := os.Getenv("OTLP_METRICS_ENDPOINT")
+	if metrics.ExportsOTLP(metricsExporter) && metricsEndpoint == "" {
+		log.Printf("METRICS_EXPORTER=%s needs OTLP_METRICS_ENDPOINT, serving metrics for Prometheus only", metricsExporter)
+		metricsExporter = metrics.ExporterPrometheus
 	}
-}
-
-func main() {
-	log.Println("Starting GenAI App with observability")
-
-	// Get configuration from environment
-	baseURL := os.Getenv("BASE_URL")
-	model := os.Getenv("MODEL")
-	apiKey := os.Getenv("API_KEY")
-
-	// Tracing setup
-	tracingEnabled, _ := strconv.ParseBool(getEnvOrDefault("TRACING_ENABLED", "false"))
-	var tracingCleanup func()
+	if metrics.ExportsOTLP(metricsExporter) {
+		metricsConfig := tracingConfig
+		metricsConfig.Endpoint = metricsEndpoint
+		log.Printf("Setting up OTLP metrics export with endpoint: %s (%s)", metricsConfig.Endpoint, metricsConfig.Protocol)
 
-	if tracingEnabled {
-		otlpEndpoint := getEnvOrDefault("OTLP_ENDPOINT", "jaeger:4318")
-		log.Printf("Setting up tracing with endpoint: %s", otlpEndpoint)
-
-		cleanup, err := tracing.SetupTracing("genai-app", otlpEndpoint)
+		err := tracingConfigErr
+		var res *resource.Resource
+		if err == nil {
+			res, err = tracing.NewResource("genai-app")
+		}
+		if err == nil {
+			var cleanup func()
+			cleanup, err = metrics.SetupOTLPExport(registry, metricsConfig, res, 15*time.Second)
+			if err == nil {
+				defer cleanup()
+			}
+		}
 		if err != nil {
-			log.Printf("Failed to set up tracing: %v", err)
-		} else {
-			tracingCleanup = cleanup
-			defer tracingCleanup()
-			log.Println("Tracing initialized successfully")
+			log.Printf("Failed to set up OTLP metrics export: %v", err)
 		}
 	}
 
-	// Create OpenAI client
+	// Create OpenAI client with an instrumented transport
 	client := openai.NewClient(
 		option.WithBaseURL(baseURL),
 		option.WithAPIKey(apiKey),
+		option.WithHTTPClient(upstream.NewClient(upstream.Metrics{
+			PhaseDuration:   rec.UpstreamPhaseDuration,
+			RequestDuration: rec.UpstreamRequestDuration,
+			Requests:        rec.UpstreamRequests,
+			Retries:         rec.UpstreamRetries,
+		})),
 	)
 
+	// Check if the model is a llama.cpp model
+	isLlamaCpp := strings.Contains(strings.ToLower(model), "llama") ||
+		strings.Contains(baseURL, "llama.cpp")
+
 	// Create router
 	mux := http.NewServeMux()
 
 	// Apply middleware
 	handlersChain := func(h http.Handler) http.Handler {
-		h = middleware.MetricsMiddleware(requestCounter, requestDuration, activeRequests)(h)
+		h = middleware.MetricsMiddleware(rec)(h)
 		if tracingEnabled {
 			h = middleware.TracingMiddleware(h)
 		}
@@ -359,7 +233,7 @@ func main() {
 		if r.Method == http.MethodOptions {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, traceparent, tracestate, baggage")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -371,10 +245,6 @@ func main() {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.WriteHeader(http.StatusOK)
 		
-		// Check if the model is a llama.cpp model
-		isLlamaCpp := strings.Contains(strings.ToLower(model), "llama") || 
-			            strings.Contains(baseURL, "llama.cpp")
-		
 		// Add model information to the health response
 		modelInfo := map[string]interface{}{
 			"model": model,
@@ -383,9 +253,8 @@ func main() {
 		// Add context window size if available
 		if isLlamaCpp {
 			modelInfo["modelType"] = "llama.cpp"
-			contextSize := int(getGaugeValueWithLabels(llamacppContextSize, model))
-			if contextSize > 0 {
-				modelInfo["contextWindow"] = contextSize
+			if reported := rec.LlamaCppMetrics(model); reported != nil {
+				modelInfo["contextWindow"] = reported.ContextSize
 			} else {
 				// Default context window for the model if not set yet
 				if strings.Contains(model, "1B") {
@@ -411,148 +280,96 @@ func main() {
 	})
 
 	// Add metrics endpoint using custom registry
-	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-	
-	// Add metrics summary endpoint for frontend
-	mux.HandleFunc("/metrics/summary", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Content-Type", "application/json")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Get llama.cpp metrics if the model is a llama.cpp model
-		var llamaCppMetrics *LlamaCppMetrics
-		if strings.Contains(strings.ToLower(model), "llama") || 
-		   strings.Contains(baseURL, "llama.cpp") {
-			llamaCppMetrics = getLlamaCppMetrics(model)
-		}
-
-		// Create a metrics summary by reading from Prometheus metrics
-		summary := MetricsSummary{
-			TotalRequests:      getCounterValue(requestCounter),
-			AverageResponseTime: getAverageResponseTime(requestDuration),
-			TokensGenerated:    getCounterValue(chatTokensCounter, "output", model),
-			TokensProcessed:    getCounterValue(chatTokensCounter, "input", model),
-			ActiveUsers:        getGaugeValue(activeRequests),
-			ErrorRate:          calculateErrorRate(),
-			LlamaCppMetrics:    llamaCppMetrics,
-		}
-
-		json.NewEncoder(w).Encode(summary)
-	})
-	
-	// Add metrics logging endpoint
-	mux.HandleFunc("/metrics/log", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Parse metrics from the request
-		var metricLog MetricLog
-		if err := json.NewDecoder(r.Body).Decode(&metricLog); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		// Log the metrics using Prometheus (don't increment counters as they are already tracked)
-		// Just log the first token latency which isn't already tracked
-		if metricLog.FirstTokenMs > 0 {
-			firstTokenLatency.WithLabelValues(model).Observe(metricLog.FirstTokenMs / 1000.0)
-		}
-
-		w.WriteHeader(http.StatusOK)
-	})
+	if metrics.ExportsPrometheus(metricsExporter) {
+		mux.Handle("/metrics", metrics.Handler(registry))
+	}
 	
-	// Add llama.cpp metrics logging endpoint
-	mux.HandleFunc("/metrics/llamacpp", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Parse metrics from the request
-		var llamaCppLog LlamaCppMetrics
-		if err := json.NewDecoder(r.Body).Decode(&llamaCppLog); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		// Record all llama.cpp metrics
-		llamacppContextSize.WithLabelValues(model).Set(float64(llamaCppLog.ContextSize))
-		llamacppPromptEvalTime.WithLabelValues(model).Observe(llamaCppLog.PromptEvalTime / 1000.0) // Convert ms to seconds
-		llamacppTokensPerSecond.WithLabelValues(model).Set(llamaCppLog.TokensPerSecond)
-		llamacppMemoryPerToken.WithLabelValues(model).Set(llamaCppLog.MemoryPerToken)
-		llamacppThreadsUsed.WithLabelValues(model).Set(float64(llamaCppLog.ThreadsUsed))
-		llamacppBatchSize.WithLabelValues(model).Set(float64(llamaCppLog.BatchSize))
+	// Frontend reports are validated, rate limited and correlated with chat requests
+	telemetryConfig := telemetry.DefaultConfig()
+	if rate, err := strconv.Atoi(getEnvOrDefault("TELEMETRY_RATE_PER_MINUTE", "60")); err == nil {
+		telemetryConfig.RatePerMinute = rate
+	} else {
+		log.Printf("Invalid TELEMETRY_RATE_PER_MINUTE, using %d: %v", telemetryConfig.RatePerMinute, err)
+	}
+	if origins := os.Getenv("TELEMETRY_ALLOWED_ORIGINS"); origins != "" {
+		telemetryConfig.AllowedOrigins = strings.Split(origins, ",")
+	}
+	ingestor := telemetry.NewIngestor(rec, model, telemetryConfig)
 
-		w.WriteHeader(http.StatusOK)
-	})
-	
-	// Add error logging endpoint
-	mux.HandleFunc("/metrics/error", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// Service level objectives are evaluated against every chat
+	mux.HandleFunc("/slo", slos.HandleSLO())
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+	// Per-message records are persisted to SQLite when ANALYTICS_DB is set
+	var store *analytics.Store
+	if dbPath := os.Getenv("ANALYTICS_DB"); dbPath != "" {
+		retention, err := time.ParseDuration(getEnvOrDefault("ANALYTICS_RETENTION", "720h"))
+		if err != nil {
+			log.Printf("Invalid ANALYTICS_RETENTION, using 720h: %v", err)
+			retention = 720 * time.Hour
 		}
-
-		// Parse error from the request
-		var errorLog ErrorLog
-		if err := json.NewDecoder(r.Body).Decode(&errorLog); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
+		store, err = analytics.Open(dbPath, retention)
+		if err != nil {
+			log.Printf("Failed to open analytics store: %v", err)
+		} else {
+			defer store.Close()
+			mux.HandleFunc("/analytics/messages", store.HandleMessages())
+			mux.HandleFunc("/analytics/export", store.HandleExport())
+			log.Printf("Storing message analytics in %s for %s", dbPath, retention)
 		}
+	}
 
-		// Log the error using Prometheus
-		errorCounter.WithLabelValues(errorLog.ErrorType).Inc()
-
-		w.WriteHeader(http.StatusOK)
-	})
+	// Add metrics summary and frontend reporting endpoints
+	mux.HandleFunc("/metrics/summary", rec.HandleSummary(model, isLlamaCpp))
+	mux.HandleFunc("/metrics/log", ingestor.HandleLogMetrics())
+	mux.HandleFunc("/metrics/llamacpp", ingestor.HandleLlamaCppMetrics())
+	mux.HandleFunc("/metrics/error", ingestor.HandleLogError())
+	mux.HandleFunc("/rum", ingestor.HandleRUM())
 
 	// Add chat endpoint with advanced tracing
-	mux.HandleFunc("/chat", handleChat(client, model, baseURL))
+	var chatHandler http.Handler = handleChat(client, rec, ingestor, store, slos, detector, model, baseURL, prices, stallThreshold)
+
+	// Fault injection is opt-in and only applies to the chat endpoint
+	faultsEnabled, _ := strconv.ParseBool(getEnvOrDefault("FAULT_INJECTION_ENABLED", "false"))
+	if faultsEnabled {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			log.Fatal("FAULT_INJECTION_ENABLED requires ADMIN_TOKEN to protect /admin/faults")
+		}
+		injector := faults.NewInjector(rec)
+		chatHandler = injector.Middleware(chatHandler)
+		mux.HandleFunc("/admin/faults", injector.HandleAdmin(adminToken))
+		log.Println("Fault injection enabled, configure it via /admin/faults")
+	}
+	mux.Handle("/chat", chatHandler)
+
+	// Add embeddings endpoints
+	mux.HandleFunc("/embeddings", handleEmbeddings(client, rec, embeddingModel))
+	mux.HandleFunc("/v1/embeddings", handleEmbeddingsPassthrough(client, rec, embeddingModel))
 
 	// Create HTTP server
 	server := &http.Server{
-		Addr:         ":8080",
+		Addr:         ":" + getEnvOrDefault("PORT", "8080"),
 		Handler:      handlersChain(mux),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 90 * time.Second,
 	}
 
 	// Start metrics server on a separate port with custom registry
-	metricsServer := &http.Server{
-		Addr:    ":9090",
-		Handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	var metricsServer *http.Server
+	if metrics.ExportsPrometheus(metricsExporter) {
+		metricsServer = metrics.SetupMetricsServer(":"+getEnvOrDefault("METRICS_PORT", "9090"), registry)
+
+		go func() {
+			log.Printf("Starting metrics server on %s", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
 	}
-	
-	go func() {
-		log.Println("Starting metrics server on :9090")
-		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start metrics server: %v", err)
-		}
-	}()
 
 	// Start the main server
 	go func() {
-		log.Println("Starting server on :8080")
+		log.Printf("Starting server on %s", server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
@@ -572,13 +389,47 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
-	if err := metricsServer.Shutdown(ctx); err != nil {
-		log.Fatalf("Metrics server forced to shutdown: %v", err)
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Fatalf("Metrics server forced to shutdown: %v", err)
+		}
 	}
 
 	log.Println("Server exiting")
 }
 
+// registerMetrics creates every application metric on reg. The rules and
+// dashboard commands call it with an inventory to follow the same metrics.
+func registerMetrics(reg prometheus.Registerer, sloConfig slo.Config, anomalyConfig anomaly.Config) (*metrics.Recorder, *slo.Tracker, *anomaly.Detector) {
+	return metrics.NewRecorder(reg), slo.NewTracker(sloConfig, reg), anomaly.NewDetector(anomalyConfig, reg)
+}
+
+// loadTracingConfig reads the tracing configuration from path, or starts from
+// the defaults when path is empty, then applies the environment
+func loadTracingConfig(path string) (tracing.Config, error) {
+	cfg := tracing.DefaultConfig()
+	if path != "" {
+		var err error
+		if cfg, err = tracing.LoadConfig(path); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, cfg.ApplyEnv(os.LookupEnv)
+}
+
+// loadSLOConfig reads the objectives from path, or returns the defaults when
+// path is empty or cannot be loaded
+func loadSLOConfig(path string) (slo.Config, error) {
+	if path == "" {
+		return slo.DefaultConfig(), nil
+	}
+	cfg, err := slo.LoadConfig(path)
+	if err != nil {
+		return slo.DefaultConfig(), err
+	}
+	return cfg, nil
+}
+
 // getEnvOrDefault gets an environment variable or returns a default value
 func getEnvOrDefault(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -588,12 +439,29 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return value
 }
 
-// handleChat handles the chat endpoint with simple tracing
-func handleChat(client *openai.Client, model string, apiBaseURL string) http.HandlerFunc {
+// writeChatEvent writes a single Server-Sent Event
+func writeChatEvent(w http.ResponseWriter, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// handleChat handles the chat endpoint with simple tracing. By default the response
+// is the raw generated text; clients sending "Accept: text/event-stream" receive
+// "data:" events for each chunk followed by a final "done" event with the request summary.
+func handleChat(client *openai.Client, rec *metrics.Recorder, ingestor *telemetry.Ingestor, store *analytics.Store, slos *slo.Tracker, detector *anomaly.Detector, model string, apiBaseURL string, prices *pricing.Table, stallThreshold time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, traceparent, tracestate, baggage")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -605,13 +473,31 @@ func handleChat(client *openai.Client, model string, apiBaseURL string) http.Han
 			return
 		}
 
+		ctx := r.Context()
+
+		// The request ID is returned to the client and matched with its telemetry by message ID
+		requestID := uuid.New().String()
+		w.Header().Set("X-Request-Id", requestID)
+		w.Header().Add("Access-Control-Expose-Headers", "X-Request-Id")
+
+		_, parseSpan := tracing.StartSpan(ctx, "parse_request")
 		var req ChatRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Printf("Invalid request body: %v", err)
+			parseSpan.RecordError(err)
+			parseSpan.End()
+			rec.RecordError(r.URL.Path, metrics.ErrorClientInput)
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			requestCounter.WithLabelValues(r.Method, r.URL.Path, fmt.Sprintf("%d", http.StatusBadRequest)).Inc()
 			return
 		}
+		parseSpan.SetAttributes(
+			attribute.Int("chat.history_messages", len(req.Messages)),
+			attribute.String("chat.request_id", requestID),
+			attribute.String("chat.message_id", req.MessageID),
+		)
+		parseSpan.End()
+
+		useEvents := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
 
 		// Set headers for SSE
 		w.Header().Set("Content-Type", "text/event-stream")
@@ -619,15 +505,12 @@ func handleChat(client *openai.Client, model string, apiBaseURL string) http.Han
 		w.Header().Set("Connection", "keep-alive")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		// Count input tokens (rough estimate)
+		// Estimate the input tokens, replaced by the usage the backend reports
 		inputTokens := 0
 		for _, msg := range req.Messages {
 			inputTokens += len(msg.Content) / 4 // Rough estimate
 		}
 		inputTokens += len(req.Message) / 4
-		
-		// Track metrics for input tokens
-		chatTokensCounter.WithLabelValues("input", model).Add(float64(inputTokens))
 
 		// Start model timing
 		start := time.Now()
@@ -635,6 +518,68 @@ func handleChat(client *openai.Client, model string, apiBaseURL string) http.Han
 		var firstTokenTime time.Time
 		outputTokens := 0
 
+		// Record the outcome in the windowed summary store
+		recordWindow := func(failed bool) {
+			observation := metrics.Observation{
+				Time:      start,
+				Duration:  time.Since(start),
+				TokensIn:  inputTokens,
+				TokensOut: outputTokens,
+				Error:     failed,
+			}
+			if !firstTokenTime.IsZero() {
+				observation.FirstToken = firstTokenTime.Sub(modelStartTime)
+			}
+			rec.ChatWindow.Record(observation)
+		}
+
+		// Keep the server measurement to compare with the frontend telemetry and RUM
+		// beacons, evaluate the objectives and baselines and persist the message
+		// for analytics.
+		// status is ok or the error type.
+		recordMessage := func(status string) {
+			server := telemetry.ServerMeasurement{
+				RequestID:    requestID,
+				Span:         trace.SpanContextFromContext(ctx),
+				Start:        start,
+				ResponseTime: time.Since(start),
+				TokensIn:     inputTokens,
+				TokensOut:    outputTokens,
+			}
+			if !firstTokenTime.IsZero() {
+				server.FirstToken = firstTokenTime.Sub(modelStartTime)
+			}
+			ingestor.RecordServer(req.MessageID, server)
+
+			outcome := slo.Outcome{Time: start, ResponseTime: server.ResponseTime, FirstToken: server.FirstToken}
+			if status != analytics.StatusOK {
+				outcome.ErrorType = status
+			}
+			slos.Record(outcome)
+			detector.Observe(anomaly.Observation{
+				Model:        model,
+				ResponseTime: server.ResponseTime,
+				FirstToken:   server.FirstToken,
+				TokensOut:    outputTokens,
+				ErrorType:    outcome.ErrorType,
+			})
+
+			store.Record(analytics.Message{
+				Time:         start,
+				RequestID:    requestID,
+				MessageID:    req.MessageID,
+				SessionID:    req.SessionID,
+				Model:        model,
+				Format:       req.Format,
+				TokensIn:     inputTokens,
+				TokensOut:    outputTokens,
+				FirstTokenMs: float64(server.FirstToken.Microseconds()) / 1000,
+				LatencyMs:    float64(server.ResponseTime.Microseconds()) / 1000,
+				Status:       status,
+			})
+		}
+
+		_, promptSpan := tracing.StartSpan(ctx, "build_prompt")
 		var messages []openai.ChatCompletionMessageParamUnion
 		for _, msg := range req.Messages {
 			var message openai.ChatCompletionMessageParamUnion
@@ -676,40 +621,142 @@ func handleChat(client *openai.Client, model string, apiBaseURL string) http.Han
 		param := openai.ChatCompletionNewParams{
 			Messages: openai.F(messages),
 			Model:    openai.F(model),
+			// The usage arrives in a last chunk, backends that ignore this get estimates
+			StreamOptions: openai.F(openai.ChatCompletionStreamOptionsParam{
+				IncludeUsage: openai.F(true),
+			}),
 		}
+		promptSpan.SetAttributes(
+			attribute.Int("chat.prompt_messages", len(messages)),
+			attribute.Bool("chat.markdown", useMarkdown),
+		)
+		promptSpan.End()
 
 		// Set prompt evaluation start time for llama.cpp metrics
 		promptEvalStartTime := time.Now()
 
-		ctx := r.Context()
-		stream := client.Chat.Completions.NewStreaming(ctx, param)
+		// The inference span covers the model stream and follows the GenAI semantic
+		// conventions. Its phases are child spans and token stalls are added as events.
+		inference := tracing.NewTracedModelInference(ctx, model)
+		inferenceCtx := inference.Ctx
+		// Every return below sets inferenceErr when the inference failed
+		var inferenceErr error
+		defer func() { inference.End(inferenceErr) }()
+
+		// Until the response headers arrive
+		inference.StartProcessing("upstream_connect")
+		stream := client.Chat.Completions.NewStreaming(inferenceCtx, param)
+		defer stream.Close()
+		inference.EndProcessing()
+
+		// Until the first token, the backend is evaluating the prompt
+		inference.StartProcessing("prompt_eval")
+		var writeTime time.Duration
+		var gaps metrics.TokenGaps
+		var responseID, responseModel string
+		var finishReasons []string
+		var usage openai.CompletionUsage
+		usageReported := false
+
+		// Record the operation in the GenAI semantic convention metrics
+		recordOperation := func(errorType string) {
+			rec.RecordGenAIOperation(metrics.GenAIOperation{
+				Operation:     tracing.GenAIOperationChat,
+				System:        tracing.GenAISystem,
+				RequestModel:  model,
+				ResponseModel: responseModel,
+				InputTokens:    inputTokens,
+				OutputTokens:   outputTokens,
+				Duration:       time.Since(modelStartTime),
+				ErrorType:      errorType,
+				UsageEstimated: !usageReported,
+			})
+		}
 
 		for stream.Next() {
 			chunk := stream.Current()
+			if responseID == "" {
+				responseID = chunk.ID
+			}
+			if chunk.Model != "" {
+				responseModel = chunk.Model
+			}
+			if !chunk.JSON.Usage.IsNull() {
+				usage, usageReported = chunk.Usage, true
+			}
+			for _, choice := range chunk.Choices {
+				if choice.FinishReason != "" {
+					finishReasons = append(finishReasons, string(choice.FinishReason))
+				}
+			}
 
 			// Record first token time
 			if firstTokenTime.IsZero() && len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
 				firstTokenTime = time.Now()
+				inference.EndProcessing()
+				inference.RecordFirstToken(firstTokenTime.Sub(modelStartTime))
+				inference.StartProcessing("generation")
 				
 				// For llama.cpp, record prompt evaluation time
 				if strings.Contains(strings.ToLower(model), "llama") || 
 				   strings.Contains(apiBaseURL, "llama.cpp") {
 					promptEvalTime := firstTokenTime.Sub(promptEvalStartTime)
-					llamacppPromptEvalTime.WithLabelValues(model).Observe(promptEvalTime.Seconds())
+					rec.LlamaCppPromptEvalTime.WithLabelValues(model).Observe(promptEvalTime.Seconds())
 				}
 			}
 
 			// Stream each chunk as it arrives
 			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				if gap, ok := gaps.Observe(time.Now()); ok && rec.RecordTokenGap(model, gap, stallThreshold) {
+					tracing.CreateEvent(inferenceCtx, "token_stall",
+						attribute.Int("stream.token_index", outputTokens),
+						attribute.Float64("stream.gap_ms", float64(gap.Microseconds())/1000),
+					)
+				}
 				outputTokens++
-				_, err := fmt.Fprintf(w, "%s", chunk.Choices[0].Delta.Content)
+				writeStart := time.Now()
+				var err error
+				if useEvents {
+					err = writeChatEvent(w, "", map[string]string{"content": chunk.Choices[0].Delta.Content})
+				} else {
+					_, err = fmt.Fprintf(w, "%s", chunk.Choices[0].Delta.Content)
+				}
 				if err != nil {
 					log.Printf("Error writing to stream: %v", err)
+					inferenceErr = err
+					errorType := metrics.ErrorStreamInterrupted
+					if errors.Is(err, faults.ErrStreamDropped) {
+						errorType = metrics.ErrorInjectedStreamInterrupted
+					}
+					rec.RecordError(r.URL.Path, errorType)
+					recordOperation(errorType)
+					recordWindow(true)
+					recordMessage(errorType)
 					return
 				}
 				w.(http.Flusher).Flush()
+				writeTime += time.Since(writeStart)
 			}
 		}
+		inference.EndProcessing()
+
+		// Summarize how smoothly the tokens were streamed
+		jitter := gaps.Stats()
+		rec.RecordStreamJitter(model, jitter)
+		inference.ParentSpan.SetAttributes(
+			attribute.Float64("stream.inter_token_mean_ms", float64(jitter.Mean.Microseconds())/1000),
+			attribute.Float64("stream.inter_token_p95_ms", float64(jitter.P95.Microseconds())/1000),
+			attribute.Float64("stream.max_token_gap_ms", float64(jitter.Max.Microseconds())/1000),
+		)
+		inference.RecordResponse(responseID, responseModel, finishReasons)
+
+		// Prefer the usage reported by the backend to the estimates, outputTokens
+		// counted the chunks so far
+		chunks := outputTokens
+		if usageReported {
+			inputTokens, outputTokens = int(usage.PromptTokens), int(usage.CompletionTokens)
+		}
+		inference.RecordTokenCounts(inputTokens, outputTokens, !usageReported)
 
 		// Calculate tokens per second for llama.cpp metrics
 		if strings.Contains(strings.ToLower(model), "llama") || 
@@ -717,26 +764,71 @@ func handleChat(client *openai.Client, model string, apiBaseURL string) http.Han
 			totalTime := time.Since(firstTokenTime).Seconds()
 			if totalTime > 0 && outputTokens > 0 {
 				tokensPerSecond := float64(outputTokens) / totalTime
-				llamacppTokensPerSecond.WithLabelValues(model).Set(tokensPerSecond)
+				rec.LlamaCppTokensPerSecond.WithLabelValues(model).Set(tokensPerSecond)
 			}
 		}
 
-		// Record metrics
-		requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(time.Since(start).Seconds())
-		requestCounter.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
-		chatTokensCounter.WithLabelValues("output", model).Add(float64(outputTokens))
-		modelLatency.WithLabelValues(model, "inference").Observe(time.Since(modelStartTime).Seconds())
+		// Record metrics, the request count and duration are recorded by MetricsMiddleware
+		rec.ChatTokensCounter.WithLabelValues("input", model).Add(float64(inputTokens))
+		rec.ChatTokensCounter.WithLabelValues("output", model).Add(float64(outputTokens))
+		inferenceTime := time.Since(modelStartTime)
+		metrics.ObserveWithTrace(inferenceCtx, rec.ModelLatency.WithLabelValues(model, "inference"), inferenceTime.Seconds())
+
+		// Estimate cost and energy from the token counts
+		estimate := prices.Estimate(model, inputTokens, outputTokens, inferenceTime)
+		rec.CostCounter.WithLabelValues(model).Add(estimate.Cost)
+		rec.EnergyCounter.WithLabelValues(model).Add(estimate.EnergyJoules)
 		
 		if !firstTokenTime.IsZero() {
 			ttft := firstTokenTime.Sub(modelStartTime).Seconds()
 			log.Printf("Time to first token: %.3f seconds", ttft)
-			firstTokenLatency.WithLabelValues(model).Observe(ttft)
+			metrics.ObserveWithTrace(inferenceCtx, rec.FirstTokenLatency.WithLabelValues(model), ttft)
 		}
 
 		if err := stream.Err(); err != nil {
-			log.Printf("Error in stream: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			errorType := classifyError(ctx, err)
+			log.Printf("Error in stream (%s): %v", errorType, err)
+			rec.RecordError(r.URL.Path, errorType)
+			recordOperation(errorType)
+			recordWindow(true)
+			recordMessage(errorType)
+			inferenceErr = err
+			http.Error(w, "Internal server error", errorStatus(errorType))
 			return
 		}
+		recordOperation("")
+		recordWindow(false)
+		recordMessage(analytics.StatusOK)
+
+		// The chunks were flushed as they arrived, this covers the end of the response
+		_, flushSpan := tracing.StartSpan(ctx, "response_flush")
+		defer flushSpan.End()
+		flushSpan.SetAttributes(
+			attribute.Int("response.chunks", chunks),
+			attribute.Float64("response.write_ms", float64(writeTime.Microseconds())/1000),
+		)
+
+		if useEvents {
+			summary := ChatSummaryEvent{
+				Model:          model,
+				TokensIn:       inputTokens,
+				TokensOut:      outputTokens,
+				ResponseTimeMs: float64(time.Since(start).Microseconds()) / 1000,
+				Cost:           estimate,
+
+				InterTokenMeanMs: float64(jitter.Mean.Microseconds()) / 1000,
+				InterTokenP95Ms:  float64(jitter.P95.Microseconds()) / 1000,
+				MaxTokenGapMs:    float64(jitter.Max.Microseconds()) / 1000,
+			}
+			if !firstTokenTime.IsZero() {
+				summary.FirstTokenMs = float64(firstTokenTime.Sub(modelStartTime).Microseconds()) / 1000
+			}
+			if err := writeChatEvent(w, "done", summary); err != nil {
+				log.Printf("Error writing summary event: %v", err)
+				flushSpan.RecordError(err)
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,232 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/rs/zerolog/log"
+)
+
+// Export formats
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// parquetBatch is the number of rows buffered before they are written to a
+// Parquet row group
+const parquetBatch = 1000
+
+// csvHeader names the CSV columns, in the order written by csvRecord
+var csvHeader = []string{
+	"id", "time", "request_id", "message_id", "session_id", "model", "format",
+	"tokens_in", "tokens_out", "time_to_first_token_ms", "latency_ms", "status",
+}
+
+// parquetMessage is the Parquet schema of an exported message
+type parquetMessage struct {
+	ID           int64     `parquet:"id"`
+	Time         time.Time `parquet:"time,timestamp(millisecond)"`
+	RequestID    string    `parquet:"request_id,dict"`
+	MessageID    string    `parquet:"message_id"`
+	SessionID    string    `parquet:"session_id,dict"`
+	Model        string    `parquet:"model,dict"`
+	Format       string    `parquet:"format,dict"`
+	TokensIn     int64     `parquet:"tokens_in"`
+	TokensOut    int64     `parquet:"tokens_out"`
+	FirstTokenMs float64   `parquet:"time_to_first_token_ms"`
+	LatencyMs    float64   `parquet:"latency_ms"`
+	Status       string    `parquet:"status,dict"`
+}
+
+// exporter writes messages to the response in one format
+type exporter interface {
+	write(msg Message) error
+	close() error
+}
+
+// HandleExport streams the stored messages, oldest first, as a file for
+// loading into spreadsheets or data tools. The format query parameter selects
+// csv, jsonl or parquet (default csv), and from, to, model, status,
+// message_format and session filter the messages as in /analytics/messages.
+func (s *Store) HandleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := req.URL.Query()
+		filter, err := ParseFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format == "" {
+			format = FormatCSV
+		}
+		var contentType string
+		var newExporter func(io.Writer) exporter
+		switch format {
+		case FormatCSV:
+			contentType, newExporter = "text/csv; charset=utf-8", newCSVExporter
+		case FormatJSONL:
+			contentType, newExporter = "application/x-ndjson", newJSONLExporter
+		case FormatParquet:
+			contentType, newExporter = "application/vnd.apache.parquet", newParquetExporter
+		default:
+			http.Error(w, "Invalid format, use csv, jsonl or parquet", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="messages-%s.%s"`,
+			time.Now().UTC().Format("20060102T150405Z"), format))
+
+		// The status is sent with the first bytes, so failures past this
+		// point can only cut the file short
+		out := newExporter(w)
+		count := 0
+		err = s.Each(req.Context(), filter, func(msg Message) error {
+			count++
+			return out.write(msg)
+		})
+		if closeErr := out.close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.Error().Err(err).Str("format", format).Int("messages", count).Msg("Failed to export analytics messages")
+			return
+		}
+		log.Debug().Str("format", format).Int("messages", count).Msg("Exported analytics messages")
+	}
+}
+
+type csvExporter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVExporter(w io.Writer) exporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) write(msg Message) error {
+	if !e.wroteHeader {
+		e.wroteHeader = true
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	return e.w.Write([]string{
+		strconv.FormatInt(msg.ID, 10),
+		msg.Time.Format(time.RFC3339Nano),
+		msg.RequestID,
+		msg.MessageID,
+		msg.SessionID,
+		msg.Model,
+		msg.Format,
+		strconv.Itoa(msg.TokensIn),
+		strconv.Itoa(msg.TokensOut),
+		strconv.FormatFloat(msg.FirstTokenMs, 'f', -1, 64),
+		strconv.FormatFloat(msg.LatencyMs, 'f', -1, 64),
+		msg.Status,
+	})
+}
+
+func (e *csvExporter) close() error {
+	// An empty export still gets its header
+	if !e.wroteHeader {
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlExporter struct {
+	enc *json.Encoder
+}
+
+func newJSONLExporter(w io.Writer) exporter {
+	return &jsonlExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonlExporter) write(msg Message) error {
+	return e.enc.Encode(msg)
+}
+
+func (e *jsonlExporter) close() error {
+	return nil
+}
+
+type parquetExporter struct {
+	w     *parquet.GenericWriter[parquetMessage]
+	batch []parquetMessage
+}
+
+func newParquetExporter(w io.Writer) exporter {
+	return &parquetExporter{
+		w:     parquet.NewGenericWriter[parquetMessage](w),
+		batch: make([]parquetMessage, 0, parquetBatch),
+	}
+}
+
+func (e *parquetExporter) write(msg Message) error {
+	e.batch = append(e.batch, parquetMessage{
+		ID:           msg.ID,
+		Time:         msg.Time,
+		RequestID:    msg.RequestID,
+		MessageID:    msg.MessageID,
+		SessionID:    msg.SessionID,
+		Model:        msg.Model,
+		Format:       msg.Format,
+		TokensIn:     int64(msg.TokensIn),
+		TokensOut:    int64(msg.TokensOut),
+		FirstTokenMs: msg.FirstTokenMs,
+		LatencyMs:    msg.LatencyMs,
+		Status:       msg.Status,
+	})
+	if len(e.batch) < parquetBatch {
+		return nil
+	}
+	return e.flush()
+}
+
+// flush writes the buffered rows as a row group, so that the writer does not
+// hold the whole file in memory
+func (e *parquetExporter) flush() error {
+	if len(e.batch) == 0 {
+		return nil
+	}
+	if _, err := e.w.Write(e.batch); err != nil {
+		return err
+	}
+	e.batch = e.batch[:0]
+	return e.w.Flush()
+}
+
+// close writes the remaining rows and the Parquet footer
+func (e *parquetExporter) close() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	return e.w.Close()
+}
@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Page sizes of /analytics/messages
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// MessagesPage is a page of messages returned by /analytics/messages
+type MessagesPage struct {
+	Messages []Message `json:"messages"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// AggregatesResponse is returned by /analytics/messages?group_by=
+type AggregatesResponse struct {
+	GroupBy    string      `json:"group_by"`
+	Aggregates []Aggregate `json:"aggregates"`
+}
+
+// HandleMessages lists stored messages, newest first. The query parameters
+// from and to (RFC 3339), model, status, format and session filter the
+// messages, limit and offset page through them, and group_by=hour or model
+// returns aggregates instead.
+func (s *Store) HandleMessages() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := req.URL.Query()
+		filter, err := ParseFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var response any
+		if groupBy := query.Get("group_by"); groupBy != "" {
+			if groupBy != GroupByHour && groupBy != GroupByModel {
+				http.Error(w, "Invalid group_by, use hour or model", http.StatusBadRequest)
+				return
+			}
+			aggregates, err := s.Aggregate(req.Context(), filter, groupBy)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to aggregate analytics messages")
+				http.Error(w, "Failed to aggregate messages", http.StatusInternalServerError)
+				return
+			}
+			response = AggregatesResponse{GroupBy: groupBy, Aggregates: aggregates}
+		} else {
+			limit, err := intParam(query, "limit", defaultLimit, 1, maxLimit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			offset, err := intParam(query, "offset", 0, 0, 1<<31-1)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			messages, total, err := s.Messages(req.Context(), filter, limit, offset)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to query analytics messages")
+				http.Error(w, "Failed to query messages", http.StatusInternalServerError)
+				return
+			}
+			response = MessagesPage{Messages: messages, Total: total, Limit: limit, Offset: offset}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Error().Err(err).Msg("Failed to encode analytics response")
+		}
+	}
+}
+
+// ParseFilter reads a Filter from the from, to, model, status, message_format
+// and session query parameters
+func ParseFilter(query url.Values) (Filter, error) {
+	filter := Filter{
+		Model:     query.Get("model"),
+		Status:    query.Get("status"),
+		Format:    query.Get("message_format"),
+		SessionID: query.Get("session"),
+	}
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s, use an RFC 3339 time such as 2024-05-01T00:00:00Z", name)
+			}
+			*t = parsed
+		}
+	}
+	return filter, nil
+}
+
+// intParam reads an integer query parameter between lo and hi
+func intParam(query url.Values, name string, def, lo, hi int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("Invalid %s, use a number between %d and %d", name, lo, hi)
+	}
+	return n, nil
+}
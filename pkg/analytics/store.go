@@ -0,0 +1,332 @@
+// Package analytics persists one record per chat message in an embedded SQLite
+// database so that message-level questions can be answered after a restart,
+// over longer periods than the in-memory summaries keep.
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+// StatusOK is the status of a successful message, failed messages store their error type instead
+const StatusOK = "ok"
+
+// queueSize bounds the messages waiting to be written
+const queueSize = 1024
+
+// Message is the record kept for one chat request
+type Message struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	MessageID string    `json:"message_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Model     string    `json:"model"`
+	Format    string    `json:"format,omitempty"`
+	TokensIn  int       `json:"tokens_in"`
+	TokensOut int       `json:"tokens_out"`
+	// FirstTokenMs is 0 when no token was received
+	FirstTokenMs float64 `json:"time_to_first_token_ms"`
+	LatencyMs    float64 `json:"latency_ms"`
+	// Status is ok or the error type of a failed request
+	Status string `json:"status"`
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	time           INTEGER NOT NULL,
+	request_id     TEXT NOT NULL,
+	message_id     TEXT NOT NULL DEFAULT '',
+	session_id     TEXT NOT NULL DEFAULT '',
+	model          TEXT NOT NULL,
+	format         TEXT NOT NULL DEFAULT '',
+	tokens_in      INTEGER NOT NULL,
+	tokens_out     INTEGER NOT NULL,
+	first_token_ms REAL NOT NULL,
+	latency_ms     REAL NOT NULL,
+	status         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_time ON messages (time);
+CREATE INDEX IF NOT EXISTS messages_model_time ON messages (model, time);
+CREATE INDEX IF NOT EXISTS messages_session ON messages (session_id);
+`
+
+// Store writes messages in the background and answers analytics queries
+type Store struct {
+	db        *sql.DB
+	retention time.Duration
+	queue     chan Message
+	done      chan struct{}
+}
+
+// Open opens or creates the database at path. Messages older than retention
+// are deleted every hour, 0 keeps them forever.
+func Open(path string, retention time.Duration) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open analytics database: %w", err)
+	}
+
+	// Writes only come from the writer goroutine, and WAL lets queries and
+	// exports read at the same time without blocking it
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create analytics schema: %w", err)
+	}
+
+	s := &Store{
+		db:        db,
+		retention: retention,
+		queue:     make(chan Message, queueSize),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Record queues msg to be written without blocking the request. Messages are
+// dropped when the writer falls behind, and a nil Store discards them.
+func (s *Store) Record(msg Message) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.queue <- msg:
+	default:
+		log.Warn().Str("request_id", msg.RequestID).Msg("Analytics queue full, dropping message")
+	}
+}
+
+// Close writes the queued messages and closes the database
+func (s *Store) Close() error {
+	close(s.queue)
+	<-s.done
+	return s.db.Close()
+}
+
+// run writes queued messages and applies the retention policy
+func (s *Store) run() {
+	defer close(s.done)
+
+	s.prune()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			if err := s.insert(msg); err != nil {
+				log.Error().Err(err).Str("request_id", msg.RequestID).Msg("Failed to store analytics message")
+			}
+		case <-ticker.C:
+			s.prune()
+		}
+	}
+}
+
+func (s *Store) insert(msg Message) error {
+	_, err := s.db.Exec(`INSERT INTO messages
+		(time, request_id, message_id, session_id, model, format, tokens_in, tokens_out, first_token_ms, latency_ms, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.Time.UnixMilli(), msg.RequestID, msg.MessageID, msg.SessionID, msg.Model, msg.Format,
+		msg.TokensIn, msg.TokensOut, msg.FirstTokenMs, msg.LatencyMs, msg.Status,
+	)
+	return err
+}
+
+// prune deletes the messages older than the retention period
+func (s *Store) prune() {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention).UnixMilli()
+	result, err := s.db.Exec(`DELETE FROM messages WHERE time < ?`, cutoff)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to apply analytics retention")
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Info().Int64("deleted", n).Dur("retention", s.retention).Msg("Pruned analytics messages")
+	}
+}
+
+// Filter selects messages. Zero fields match everything.
+type Filter struct {
+	From      time.Time
+	To        time.Time
+	Model     string
+	Status    string
+	Format    string
+	SessionID string
+}
+
+// where builds the SQL condition and arguments for f
+func (f Filter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	if !f.From.IsZero() {
+		add("time >= ?", f.From.UnixMilli())
+	}
+	if !f.To.IsZero() {
+		add("time < ?", f.To.UnixMilli())
+	}
+	if f.Model != "" {
+		add("model = ?", f.Model)
+	}
+	if f.Status != "" {
+		add("status = ?", f.Status)
+	}
+	if f.Format != "" {
+		add("format = ?", f.Format)
+	}
+	if f.SessionID != "" {
+		add("session_id = ?", f.SessionID)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Messages returns the messages matching f, newest first, and the total
+// number of matches
+func (s *Store) Messages(ctx context.Context, f Filter, limit, offset int) ([]Message, int, error) {
+	where, args := f.where()
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM messages"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, selectMessages+where+` ORDER BY time DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, total, rows.Err()
+}
+
+// Each calls fn for every message matching f, oldest first, without loading
+// them all in memory. It stops at the first error returned by fn.
+func (s *Store) Each(ctx context.Context, f Filter, fn func(Message) error) error {
+	where, args := f.where()
+	rows, err := s.db.QueryContext(ctx, selectMessages+where+` ORDER BY time, id`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const selectMessages = `SELECT id, time, request_id, message_id, session_id, model, format,
+	tokens_in, tokens_out, first_token_ms, latency_ms, status FROM messages`
+
+// scanMessage reads the current row of a selectMessages query
+func scanMessage(rows *sql.Rows) (Message, error) {
+	var msg Message
+	var ms int64
+	if err := rows.Scan(&msg.ID, &ms, &msg.RequestID, &msg.MessageID, &msg.SessionID, &msg.Model, &msg.Format,
+		&msg.TokensIn, &msg.TokensOut, &msg.FirstTokenMs, &msg.LatencyMs, &msg.Status); err != nil {
+		return msg, fmt.Errorf("failed to read message: %w", err)
+	}
+	msg.Time = time.UnixMilli(ms).UTC()
+	return msg, nil
+}
+
+// Aggregation groupings
+const (
+	GroupByHour  = "hour"
+	GroupByModel = "model"
+)
+
+// Aggregate summarizes the messages of one hour or one model
+type Aggregate struct {
+	Hour            *time.Time `json:"hour,omitempty"`
+	Model           string     `json:"model,omitempty"`
+	Messages        int        `json:"messages"`
+	Errors          int        `json:"errors"`
+	TokensIn        int        `json:"tokens_in"`
+	TokensOut       int        `json:"tokens_out"`
+	AvgLatencyMs    float64    `json:"avg_latency_ms"`
+	MaxLatencyMs    float64    `json:"max_latency_ms"`
+	AvgFirstTokenMs float64    `json:"avg_time_to_first_token_ms"`
+}
+
+// Aggregate groups the messages matching f by hour or model
+func (s *Store) Aggregate(ctx context.Context, f Filter, groupBy string) ([]Aggregate, error) {
+	var key string
+	switch groupBy {
+	case GroupByHour:
+		key = "time / 3600000"
+	case GroupByModel:
+		key = "model"
+	default:
+		return nil, fmt.Errorf("unknown grouping %q, use hour or model", groupBy)
+	}
+
+	where, args := f.where()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+key+` AS bucket, COUNT(*),
+		SUM(CASE WHEN status = '`+StatusOK+`' THEN 0 ELSE 1 END),
+		SUM(tokens_in), SUM(tokens_out), AVG(latency_ms), MAX(latency_ms),
+		COALESCE(AVG(NULLIF(first_token_ms, 0)), 0)
+		FROM messages`+where+` GROUP BY bucket ORDER BY bucket`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate messages: %w", err)
+	}
+	defer rows.Close()
+
+	aggregates := []Aggregate{}
+	for rows.Next() {
+		var agg Aggregate
+		var bucket any
+		if err := rows.Scan(&bucket, &agg.Messages, &agg.Errors, &agg.TokensIn, &agg.TokensOut,
+			&agg.AvgLatencyMs, &agg.MaxLatencyMs, &agg.AvgFirstTokenMs); err != nil {
+			return nil, fmt.Errorf("failed to read aggregate: %w", err)
+		}
+		switch b := bucket.(type) {
+		case int64:
+			hour := time.UnixMilli(b * 3600000).UTC()
+			agg.Hour = &hour
+		case string:
+			agg.Model = b
+		}
+		aggregates = append(aggregates, agg)
+	}
+	return aggregates, rows.Err()
+}
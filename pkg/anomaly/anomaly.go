@@ -0,0 +1,461 @@
+// Package anomaly flags chat latency, throughput and error rate that deviate
+// from rolling per-model baselines, where static thresholds would not fit
+// models of different sizes.
+package anomaly
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// Signals with a baseline per model
+const (
+	SignalFirstToken      = "time_to_first_token"
+	SignalTokensPerSecond = "tokens_per_second"
+	SignalErrorRate       = "error_rate"
+)
+
+// Event states
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// signal describes how a signal is scored
+type signal struct {
+	name string
+	// lowerIsWorse flips the score so a positive score is always a degradation
+	lowerIsWorse bool
+	// floor is the smallest standard deviation used, so a very stable
+	// baseline does not turn tiny changes into anomalies
+	floor float64
+	// binomial marks a fraction of requests, whose point values are at least
+	// as noisy as the binomial standard error of the interval
+	binomial bool
+}
+
+var signals = []signal{
+	{name: SignalFirstToken, floor: 0.05},
+	{name: SignalTokensPerSecond, lowerIsWorse: true, floor: 1},
+	{name: SignalErrorRate, binomial: true},
+}
+
+// relativeFloor is the smallest standard deviation as a fraction of the baseline mean
+const relativeFloor = 0.1
+
+// anomalousWeight scales Alpha for points flagged as anomalous
+const anomalousWeight = 0.1
+
+// noDataIntervals is the number of intervals in a row without a point after
+// which a score is removed and an anomaly resolved, so that a quiet interval
+// during an incident does not resolve it
+const noDataIntervals = 5
+
+// Config controls the baselines and when deviations are flagged
+type Config struct {
+	// Interval is how often the observations are aggregated into one point per model
+	Interval time.Duration
+	// Alpha is the weight of each new point in the moving averages
+	Alpha float64
+	// Threshold is the score, in standard deviations, above which a point is anomalous
+	Threshold float64
+	// Warmup is the number of points a baseline needs before it is used
+	Warmup int
+	// MinRequests is the number of requests an interval needs to be evaluated
+	MinRequests int
+	// Seasonal keeps a baseline per hour of the day, used once warmed up
+	Seasonal bool
+	// SeasonalAlpha is the weight of each day in the hourly baselines
+	SeasonalAlpha float64
+	// SeasonalWarmup is the number of days an hourly baseline needs before it is used
+	SeasonalWarmup int
+	// WebhookURL receives every event as JSON when set
+	WebhookURL string
+}
+
+// DefaultConfig scores one-minute points against baselines that mostly
+// reflect the last 20 minutes, seasonal per hour of the day over the last
+// week once three days were seen
+func DefaultConfig() Config {
+	return Config{
+		Interval:       time.Minute,
+		Alpha:          0.1,
+		Threshold:      3,
+		Warmup:         10,
+		MinRequests:    3,
+		Seasonal:       true,
+		SeasonalAlpha:  0.3,
+		SeasonalWarmup: 3,
+	}
+}
+
+// Observation is the outcome of one chat request
+type Observation struct {
+	Model        string
+	ResponseTime time.Duration
+	// FirstToken is zero when no token was received
+	FirstToken time.Duration
+	TokensOut  int
+	// ErrorType is empty for a successful request
+	ErrorType string
+}
+
+// Event is logged and sent to the webhook when a signal becomes anomalous
+// and when it returns to its baseline
+type Event struct {
+	Time     time.Time `json:"time"`
+	State    string    `json:"state"`
+	Model    string    `json:"model"`
+	Signal   string    `json:"signal"`
+	Value    float64   `json:"value"`
+	Baseline float64   `json:"baseline"`
+	StdDev   float64   `json:"stddev"`
+	Score    float64   `json:"score"`
+	Seasonal bool      `json:"seasonal"`
+	// Reason explains a resolved event sent without a new point
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReasonNoData resolves an anomaly when several intervals in a row had too
+// few requests to be evaluated
+const ReasonNoData = "no_data"
+
+// baseline is an exponentially weighted mean and variance
+type baseline struct {
+	mean     float64
+	variance float64
+	n        int
+}
+
+func (b *baseline) update(x, alpha float64) {
+	if b.n == 0 {
+		b.mean = x
+	} else {
+		diff := x - b.mean
+		incr := alpha * diff
+		b.mean += incr
+		b.variance = (1 - alpha) * (b.variance + diff*incr)
+	}
+	b.n++
+}
+
+// series is the baseline state of one signal of one model
+type series struct {
+	global baseline
+	hourly [24]baseline
+	// hour is the hour whose points are summed up in hourSum and hourWeight,
+	// they are added to its hourly baseline once the hour is over
+	hour       time.Time
+	hourSum    float64
+	hourWeight float64
+
+	anomalous bool
+	// missed counts the intervals since the last point
+	missed int
+}
+
+// addToHour adds a point to the aggregate of its hour, first moving a
+// finished hour into the hourly baselines
+func (s *series) addToHour(now time.Time, value, weight, alpha float64) {
+	year, month, day := now.Date()
+	hour := time.Date(year, month, day, now.Hour(), 0, 0, 0, now.Location())
+	if !hour.Equal(s.hour) {
+		if s.hourWeight > 0 {
+			s.hourly[s.hour.Hour()].update(s.hourSum/s.hourWeight, alpha)
+		}
+		s.hour, s.hourSum, s.hourWeight = hour, 0, 0
+	}
+	s.hourSum += weight * value
+	s.hourWeight += weight
+}
+
+// bucket accumulates the observations of a model during an interval
+type bucket struct {
+	requests    int
+	failures    int
+	firstTokens int
+	firstSum    float64
+	tokens      int
+	streamSum   float64
+}
+
+// Detector aggregates observations per model and interval, scores them
+// against the baselines and reports anomalies
+type Detector struct {
+	cfg     Config
+	webhook *webhook
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	series  map[string]map[string]*series
+
+	score     *prometheus.GaugeVec
+	baseline  *prometheus.GaugeVec
+	anomalies *prometheus.CounterVec
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDetector creates a detector and registers its metrics with reg. A nil
+// reg uses the Prometheus default registerer. Start begins the evaluation.
+func NewDetector(cfg Config, reg prometheus.Registerer) *Detector {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	factory := metrics.With(reg)
+
+	d := &Detector{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+		series:  make(map[string]map[string]*series),
+		score: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "genai_app_anomaly_score",
+				Help: "Deviation of the last interval from the model baseline in standard deviations, positive when worse",
+			},
+			[]string{"model", "signal"},
+		),
+		baseline: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "genai_app_anomaly_baseline",
+				Help: "Expected value of each signal for the model",
+			},
+			[]string{"model", "signal"},
+		),
+		anomalies: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "genai_app_anomalies_total",
+				Help: "Anomalies detected per model and signal",
+			},
+			[]string{"model", "signal"},
+		),
+		done: make(chan struct{}),
+	}
+	return d
+}
+
+// Start evaluates the observations every cfg.Interval until Close
+func (d *Detector) Start() {
+	if d.cfg.WebhookURL != "" {
+		d.webhook = newWebhook(d.cfg.WebhookURL)
+	}
+	d.wg.Add(1)
+	go d.run()
+}
+
+// Observe adds a chat outcome to the current interval. Invalid requests and
+// streams cut by the client are ignored, they say nothing about the model. A
+// nil Detector discards observations.
+func (d *Detector) Observe(o Observation) {
+	if d == nil || o.ErrorType == metrics.ErrorClientInput || o.ErrorType == metrics.ErrorStreamInterrupted {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.buckets[o.Model]
+	if !ok {
+		b = &bucket{}
+		d.buckets[o.Model] = b
+	}
+	b.requests++
+	if o.ErrorType != "" {
+		b.failures++
+		return
+	}
+	if o.FirstToken > 0 {
+		b.firstTokens++
+		b.firstSum += o.FirstToken.Seconds()
+		if stream := o.ResponseTime - o.FirstToken; stream > 0 && o.TokensOut > 1 {
+			b.tokens += o.TokensOut
+			b.streamSum += stream.Seconds()
+		}
+	}
+}
+
+// Close stops the evaluation and delivers the pending webhook events
+func (d *Detector) Close() {
+	close(d.done)
+	d.wg.Wait()
+	if d.webhook != nil {
+		d.webhook.close()
+	}
+}
+
+func (d *Detector) run() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			d.evaluate(now)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// evaluate turns the buckets of the past interval into one point per model
+// and signal, and scores each point before adding it to the baselines
+func (d *Detector) evaluate(now time.Time) {
+	d.mu.Lock()
+	buckets := d.buckets
+	d.buckets = make(map[string]*bucket)
+	d.mu.Unlock()
+
+	for _, bySignal := range d.series {
+		for _, s := range bySignal {
+			s.missed++
+		}
+	}
+	for model, b := range buckets {
+		if b.requests < d.cfg.MinRequests {
+			continue
+		}
+		values := map[string]float64{
+			SignalErrorRate: float64(b.failures) / float64(b.requests),
+		}
+		if b.firstTokens > 0 {
+			values[SignalFirstToken] = b.firstSum / float64(b.firstTokens)
+		}
+		if b.streamSum > 0 {
+			values[SignalTokensPerSecond] = float64(b.tokens) / b.streamSum
+		}
+		for _, sig := range signals {
+			if value, ok := values[sig.name]; ok {
+				d.evaluateSignal(now, model, sig, value, b.requests)
+			}
+		}
+	}
+
+	// A score without new points turns stale, and an anomaly nobody can
+	// confirm any more is resolved
+	for model, bySignal := range d.series {
+		for name, s := range bySignal {
+			if s.missed < noDataIntervals {
+				continue
+			}
+			d.score.DeleteLabelValues(model, name)
+			if s.anomalous {
+				s.anomalous = false
+				d.report(Event{
+					Time:     now,
+					State:    StateResolved,
+					Model:    model,
+					Signal:   name,
+					Baseline: s.global.mean,
+					Reason:   ReasonNoData,
+				})
+			}
+		}
+	}
+}
+
+// evaluateSignal scores the value of a signal over requests requests
+func (d *Detector) evaluateSignal(now time.Time, model string, sig signal, value float64, requests int) {
+	s := d.seriesFor(model, sig.name)
+	s.missed = 0
+	hour := &s.hourly[now.Hour()]
+
+	// Expect the value of the same hour on earlier days once there are enough
+	// of them. The hourly baselines hold one point per day, so the spread of
+	// single points still comes from the global baseline.
+	mean, seasonal := s.global.mean, false
+	if d.cfg.Seasonal && hour.n >= d.cfg.SeasonalWarmup {
+		mean, seasonal = hour.mean, true
+	}
+	if s.global.n >= d.cfg.Warmup {
+		stddev := math.Max(math.Sqrt(s.global.variance), math.Max(relativeFloor*math.Abs(mean), sig.floor))
+		if sig.binomial {
+			// The rule of succession keeps a baseline without failures from
+			// flagging the first one
+			p := (mean*float64(requests) + 1) / float64(requests+2)
+			stddev = math.Max(stddev, math.Sqrt(p*(1-p)/float64(requests)))
+		}
+		score := (value - mean) / stddev
+		if sig.lowerIsWorse {
+			score = -score
+		}
+		d.score.WithLabelValues(model, sig.name).Set(score)
+		d.baseline.WithLabelValues(model, sig.name).Set(mean)
+
+		anomalous := score > d.cfg.Threshold
+		if anomalous != s.anomalous {
+			s.anomalous = anomalous
+			event := Event{
+				Time:     now,
+				State:    StateResolved,
+				Model:    model,
+				Signal:   sig.name,
+				Value:    value,
+				Baseline: mean,
+				StdDev:   stddev,
+				Score:    score,
+				Seasonal: seasonal,
+			}
+			if anomalous {
+				event.State = StateFiring
+				d.anomalies.WithLabelValues(model, sig.name).Inc()
+			}
+			d.report(event)
+		}
+	}
+
+	// Anomalous points barely move the baselines, so an ongoing incident stays
+	// flagged while a lasting change still becomes the new normal
+	alpha, weight := d.cfg.Alpha, 1.0
+	if s.anomalous {
+		alpha *= anomalousWeight
+		weight = anomalousWeight
+	}
+	s.global.update(value, alpha)
+	if d.cfg.Seasonal {
+		s.addToHour(now, value, weight, d.cfg.SeasonalAlpha)
+	}
+}
+
+func (d *Detector) seriesFor(model, signal string) *series {
+	bySignal, ok := d.series[model]
+	if !ok {
+		bySignal = make(map[string]*series)
+		d.series[model] = bySignal
+	}
+	s, ok := bySignal[signal]
+	if !ok {
+		s = &series{}
+		bySignal[signal] = s
+	}
+	return s
+}
+
+// report logs the event and sends it to the webhook
+func (d *Detector) report(e Event) {
+	entry := log.Warn()
+	msg := "Anomaly detected"
+	if e.State == StateResolved {
+		entry = log.Info()
+		msg = "Anomaly resolved"
+	}
+	if e.Reason != "" {
+		entry = entry.Str("reason", e.Reason)
+	}
+	entry.Str("model", e.Model).
+		Str("signal", e.Signal).
+		Float64("value", e.Value).
+		Float64("baseline", e.Baseline).
+		Float64("stddev", e.StdDev).
+		Float64("score", e.Score).
+		Bool("seasonal", e.Seasonal).
+		Msg(msg)
+
+	if d.webhook != nil {
+		d.webhook.send(e)
+	}
+}
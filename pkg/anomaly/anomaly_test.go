@@ -0,0 +1,268 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const model = "m"
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestDetector(cfg Config) *Detector {
+	return NewDetector(cfg, prometheus.NewRegistry())
+}
+
+// testConfig is the default config without the hourly baselines
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Seasonal = false
+	return cfg
+}
+
+// observe adds n chats, the first failures of them failing, that get their
+// first token after firstToken and then stream 100 tokens at tokensPerSecond
+func observe(d *Detector, n, failures int, firstToken time.Duration, tokensPerSecond float64) {
+	stream := time.Duration(100 / tokensPerSecond * float64(time.Second))
+	for i := 0; i < n; i++ {
+		o := Observation{Model: model, ResponseTime: firstToken + stream, FirstToken: firstToken, TokensOut: 100}
+		if i < failures {
+			o = Observation{Model: model, ErrorType: metrics.ErrorUpstream5xx}
+		}
+		d.Observe(o)
+	}
+}
+
+// warmUp evaluates cfg.Warmup intervals of 5 successful chats and returns
+// the time of the next interval
+func warmUp(d *Detector, firstToken time.Duration, tokensPerSecond float64) time.Time {
+	now := start
+	for i := 0; i < d.cfg.Warmup; i++ {
+		observe(d, 5, 0, firstToken, tokensPerSecond)
+		d.evaluate(now)
+		now = now.Add(d.cfg.Interval)
+	}
+	return now
+}
+
+func (d *Detector) testSeries(signal string) *series {
+	return d.series[model][signal]
+}
+
+func (d *Detector) testScore(signal string) float64 {
+	return testutil.ToFloat64(d.score.WithLabelValues(model, signal))
+}
+
+func TestWarmup(t *testing.T) {
+	d := newTestDetector(testConfig())
+	now := warmUp(d, 200*time.Millisecond, 50)
+	if got := testutil.CollectAndCount(d.score); got != 0 {
+		t.Fatalf("score series during warmup = %d, want 0", got)
+	}
+
+	observe(d, 5, 0, 200*time.Millisecond, 50)
+	d.evaluate(now)
+	if got := testutil.CollectAndCount(d.score); got != len(signals) {
+		t.Fatalf("score series after warmup = %d, want %d", got, len(signals))
+	}
+	for _, sig := range signals {
+		if got := d.testScore(sig.name); got != 0 {
+			t.Errorf("%s score of an unchanged point = %v, want 0", sig.name, got)
+		}
+	}
+}
+
+func TestFiringAndResolved(t *testing.T) {
+	d := newTestDetector(testConfig())
+	now := warmUp(d, 200*time.Millisecond, 50)
+	s := func() *series { return d.testSeries(SignalFirstToken) }
+
+	// (2s - 0.2s) / 0.05s floor
+	observe(d, 5, 0, 2*time.Second, 50)
+	d.evaluate(now)
+	if got := d.testScore(SignalFirstToken); math.Abs(got-36) > 1e-9 {
+		t.Errorf("score = %v, want 36", got)
+	}
+	if !s().anomalous {
+		t.Fatal("time to first token 10 times over its baseline is not anomalous")
+	}
+	if got := testutil.ToFloat64(d.anomalies.WithLabelValues(model, SignalFirstToken)); got != 1 {
+		t.Errorf("anomalies = %v, want 1", got)
+	}
+
+	// The anomalous point barely moved the baseline
+	if mean := s().global.mean; mean > 0.22 {
+		t.Errorf("baseline after an anomalous point = %v, want at most 0.22", mean)
+	}
+
+	observe(d, 5, 0, 200*time.Millisecond, 50)
+	d.evaluate(now.Add(d.cfg.Interval))
+	if s().anomalous {
+		t.Error("anomaly not resolved by a point back at the baseline")
+	}
+	if got := testutil.ToFloat64(d.anomalies.WithLabelValues(model, SignalFirstToken)); got != 1 {
+		t.Errorf("anomalies after resolving = %v, want 1", got)
+	}
+}
+
+func TestErrorRateBinomialFloor(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  int
+		failures  int
+		anomalous bool
+	}{
+		{"one failure in 16", 16, 1, false},
+		{"one failure in 3", 3, 1, false},
+		{"two failures in 3", 3, 2, false},
+		{"all of 3 failing", 3, 3, true},
+		{"half of 16 failing", 16, 8, true},
+		{"5 failures in 100", 100, 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(testConfig())
+			now := warmUp(d, 200*time.Millisecond, 50)
+
+			observe(d, tt.requests, tt.failures, 200*time.Millisecond, 50)
+			d.evaluate(now)
+			if got := d.testSeries(SignalErrorRate).anomalous; got != tt.anomalous {
+				t.Errorf("anomalous = %v with score %v, want %v", got, d.testScore(SignalErrorRate), tt.anomalous)
+			}
+		})
+	}
+}
+
+func TestLowerIsWorse(t *testing.T) {
+	tests := []struct {
+		name            string
+		tokensPerSecond float64
+		score           float64
+		anomalous       bool
+	}{
+		// 50 tokens per second with a standard deviation floor of 10% of the mean
+		{"slower", 10, 8, true},
+		{"faster", 100, -10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(testConfig())
+			now := warmUp(d, 200*time.Millisecond, 50)
+
+			observe(d, 5, 0, 200*time.Millisecond, tt.tokensPerSecond)
+			d.evaluate(now)
+			if got := d.testScore(SignalTokensPerSecond); math.Abs(got-tt.score) > 1e-9 {
+				t.Errorf("score = %v, want %v", got, tt.score)
+			}
+			if got := d.testSeries(SignalTokensPerSecond).anomalous; got != tt.anomalous {
+				t.Errorf("anomalous = %v, want %v", got, tt.anomalous)
+			}
+		})
+	}
+}
+
+func TestNoDataResolvesAfterSeveralIntervals(t *testing.T) {
+	d := newTestDetector(testConfig())
+	now := warmUp(d, 200*time.Millisecond, 50)
+	s := d.testSeries(SignalFirstToken)
+
+	next := func() time.Time {
+		now = now.Add(d.cfg.Interval)
+		return now
+	}
+	spike := func() {
+		observe(d, 5, 0, 2*time.Second, 50)
+		d.evaluate(next())
+	}
+	quiet := func(intervals int) {
+		for i := 0; i < intervals; i++ {
+			// Fewer chats than MinRequests, or none
+			observe(d, i%d.cfg.MinRequests, 0, 2*time.Second, 50)
+			d.evaluate(next())
+		}
+	}
+
+	spike()
+	quiet(noDataIntervals - 1)
+	if !s.anomalous {
+		t.Fatal("anomaly resolved before noDataIntervals quiet intervals")
+	}
+	if got := testutil.CollectAndCount(d.score); got != len(signals) {
+		t.Errorf("score series = %d, want %d", got, len(signals))
+	}
+
+	// A scored point starts the count over
+	spike()
+	quiet(noDataIntervals - 1)
+	if !s.anomalous {
+		t.Fatal("anomaly resolved although a point was scored in between")
+	}
+
+	quiet(1)
+	if s.anomalous {
+		t.Error("anomaly not resolved after noDataIntervals quiet intervals")
+	}
+	if got := testutil.CollectAndCount(d.score); got != 0 {
+		t.Errorf("score series after noDataIntervals quiet intervals = %d, want 0", got)
+	}
+	if got := testutil.ToFloat64(d.anomalies.WithLabelValues(model, SignalFirstToken)); got != 1 {
+		t.Errorf("anomalies = %v, want 1", got)
+	}
+}
+
+func TestHourlyBaselineRollover(t *testing.T) {
+	cfg := DefaultConfig()
+	// Keep every point at full weight
+	cfg.Threshold = math.Inf(1)
+	d := newTestDetector(cfg)
+
+	point := func(at time.Time, firstToken time.Duration) {
+		observe(d, 5, 0, firstToken, 50)
+		d.evaluate(at)
+	}
+	// Hour 10 averages 0.2s, hour 11 takes 1s
+	day := func(n int) {
+		date := start.AddDate(0, 0, n)
+		for i, ms := range []time.Duration{100, 200, 300} {
+			point(date.Add(10*time.Hour+time.Duration(i)*20*time.Minute), ms*time.Millisecond)
+		}
+		for i := 0; i < 3; i++ {
+			point(date.Add(11*time.Hour+time.Duration(i)*20*time.Minute), time.Second)
+		}
+	}
+
+	day(0)
+	s := d.testSeries(SignalFirstToken)
+	if n := s.hourly[10].n; n != 1 {
+		t.Fatalf("hour 10 has %d points after a day, want 1", n)
+	}
+	if mean := s.hourly[10].mean; math.Abs(mean-0.2) > 1e-9 {
+		t.Errorf("hour 10 baseline = %v, want the hourly mean 0.2", mean)
+	}
+	if n := s.hourly[11].n; n != 0 {
+		t.Errorf("hour 11 has %d points before it is over, want 0", n)
+	}
+
+	day(1)
+	day(2)
+	if n := s.hourly[10].n; n != cfg.SeasonalWarmup {
+		t.Fatalf("hour 10 has %d points after 3 days, want %d", n, cfg.SeasonalWarmup)
+	}
+
+	// Hour 10 is scored against its own baseline from now on
+	point(start.AddDate(0, 0, 3).Add(10*time.Hour), 200*time.Millisecond)
+	if got := testutil.ToFloat64(d.baseline.WithLabelValues(model, SignalFirstToken)); math.Abs(got-0.2) > 1e-9 {
+		t.Errorf("baseline = %v, want the hour 10 baseline 0.2", got)
+	}
+	if got := d.testScore(SignalFirstToken); math.Abs(got) > 1e-9 {
+		t.Errorf("score = %v, want 0", got)
+	}
+	if n := s.hourly[10].n; n != cfg.SeasonalWarmup {
+		t.Errorf("hour 10 has %d points while it is under way, want %d", n, cfg.SeasonalWarmup)
+	}
+}
@@ -0,0 +1,74 @@
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// webhookQueueSize bounds the events waiting to be delivered
+const webhookQueueSize = 100
+
+// webhook posts events as JSON in the background so a slow receiver never
+// delays the evaluation
+type webhook struct {
+	url    string
+	client *http.Client
+	queue  chan Event
+	done   chan struct{}
+}
+
+func newWebhook(url string) *webhook {
+	w := &webhook{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan Event, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send queues e, dropping it when the receiver falls behind
+func (w *webhook) send(e Event) {
+	select {
+	case w.queue <- e:
+	default:
+		log.Warn().Str("model", e.Model).Str("signal", e.Signal).Msg("Anomaly webhook queue full, dropping event")
+	}
+}
+
+// close delivers the queued events and stops the sender
+func (w *webhook) close() {
+	close(w.queue)
+	<-w.done
+}
+
+func (w *webhook) run() {
+	defer close(w.done)
+	for e := range w.queue {
+		if err := w.post(e); err != nil {
+			log.Error().Err(err).Str("model", e.Model).Str("signal", e.Signal).Msg("Failed to send anomaly event")
+		}
+	}
+}
+
+func (w *webhook) post(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+// Package dashboard generates the Grafana dashboard from the metrics the
+// application registers, with one panel per metric family and SLO panels.
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/ajeetraina/genai-app-demo/pkg/slo"
+)
+
+// Grid dimensions of the generated panels
+const (
+	gridWidth   = 24
+	panelWidth  = 12
+	panelHeight = 8
+	statWidth   = 6
+)
+
+// datasource points every panel at the datasource template variable
+var datasource = &Datasource{Type: "prometheus", UID: "${datasource}"}
+
+// quantiles are drawn for every histogram
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// sloPrefix names the families covered by the SLO panels
+const sloPrefix = "genai_app_slo_"
+
+// section is a dashboard row gathering the families that start with one of its prefixes
+type section struct {
+	title    string
+	prefixes []string
+}
+
+// sections order the rows. Families matching no prefix go to a last "Other" row,
+// so new metrics always get a panel.
+var sections = []section{
+	{"HTTP", []string{"genai_app_http_", "genai_app_active_requests", "genai_app_errors_"}},
+	{"Model", []string{"genai_app_model_", "genai_app_first_token_", "genai_app_chat_tokens_", "genai_app_inter_token_", "genai_app_stream_", "genai_app_token_stalls_"}},
+	{"Anomalies", []string{"genai_app_anomal"}},
+	{"GenAI semantic conventions", []string{"gen_ai_", "genai_app_token_usage_"}},
+	{"Model backend", []string{"genai_app_upstream_"}},
+	{"Embeddings", []string{"genai_app_embedding_"}},
+	{"llama.cpp", []string{"genai_app_llamacpp_"}},
+	{"Cost and energy", []string{"genai_app_cost_", "genai_app_energy_"}},
+	{"Frontend telemetry", []string{"genai_app_frontend_", "genai_app_telemetry_", "genai_app_client_"}},
+	{"Internals", []string{"genai_app_injected_", "genai_app_dropped_"}},
+}
+
+// Dashboard is the subset of the Grafana dashboard model the generator uses
+type Dashboard struct {
+	UID           string         `json:"uid"`
+	Title         string         `json:"title"`
+	Tags          []string       `json:"tags"`
+	Editable      bool           `json:"editable"`
+	Refresh       string         `json:"refresh"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Time          TimeRange      `json:"time"`
+	Templating    Templating     `json:"templating"`
+	Annotations   map[string]any `json:"annotations"`
+	Panels        []Panel        `json:"panels"`
+}
+
+// TimeRange is the default time range of the dashboard
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Templating holds the dashboard variables
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+// Variable is a dashboard template variable
+type Variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label,omitempty"`
+	Type       string      `json:"type"`
+	Query      any         `json:"query"`
+	Datasource *Datasource `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	AllValue   string      `json:"allValue,omitempty"`
+	Sort       int         `json:"sort,omitempty"`
+}
+
+// Datasource references a Grafana datasource
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// GridPos places a panel on the 24 column grid
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Panel is a dashboard panel or row
+type Panel struct {
+	ID          int            `json:"id"`
+	Type        string         `json:"type"`
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	GridPos     GridPos        `json:"gridPos"`
+	Datasource  *Datasource    `json:"datasource,omitempty"`
+	FieldConfig *FieldConfig   `json:"fieldConfig,omitempty"`
+	Options     map[string]any `json:"options,omitempty"`
+	Targets     []Target       `json:"targets,omitempty"`
+}
+
+// FieldConfig sets the unit, range and thresholds of a panel
+type FieldConfig struct {
+	Defaults  FieldDefaults `json:"defaults"`
+	Overrides []any         `json:"overrides"`
+}
+
+// FieldDefaults are the field settings applied to every series
+type FieldDefaults struct {
+	Unit       string            `json:"unit,omitempty"`
+	Thresholds *Thresholds       `json:"thresholds,omitempty"`
+	Color      map[string]string `json:"color,omitempty"`
+}
+
+// Thresholds color values from the step they reach
+type Thresholds struct {
+	Mode  string      `json:"mode"`
+	Steps []Threshold `json:"steps"`
+}
+
+// Threshold is one step, a nil Value is the base color
+type Threshold struct {
+	Color string   `json:"color"`
+	Value *float64 `json:"value"`
+}
+
+// Target is a Prometheus query of a panel
+type Target struct {
+	Datasource   *Datasource `json:"datasource"`
+	Expr         string      `json:"expr"`
+	LegendFormat string      `json:"legendFormat,omitempty"`
+	RefID        string      `json:"refId"`
+}
+
+// Options configure the generated dashboard
+type Options struct {
+	UID   string
+	Title string
+	// Objectives get compliance, error budget and burn rate panels
+	Objectives []slo.Objective
+}
+
+// DefaultOptions replace the provisioned dashboard and show the default SLOs
+func DefaultOptions() Options {
+	return Options{
+		UID:        "llm-dashboard",
+		Title:      "LLM Performance Dashboard",
+		Objectives: slo.DefaultConfig().Objectives,
+	}
+}
+
+// builder lays out panels row by row
+type builder struct {
+	panels []Panel
+	x, y   int
+}
+
+// row starts a new dashboard row
+func (b *builder) row(title string) {
+	b.newline()
+	b.add(Panel{Type: "row", Title: title}, gridWidth, 1)
+}
+
+// add places p after the previous panel, wrapping to a new line when needed
+func (b *builder) add(p Panel, w, h int) {
+	if b.x+w > gridWidth {
+		b.newline()
+	}
+	p.ID = len(b.panels) + 1
+	p.GridPos = GridPos{H: h, W: w, X: b.x, Y: b.y}
+	b.panels = append(b.panels, p)
+	b.x += w
+	if b.x >= gridWidth {
+		b.x = 0
+		b.y += h
+	}
+}
+
+// newline moves below the current line of panels
+func (b *builder) newline() {
+	if b.x == 0 {
+		return
+	}
+	last := b.panels[len(b.panels)-1]
+	b.x = 0
+	b.y = last.GridPos.Y + last.GridPos.H
+}
+
+// Build generates the dashboard for the families in inv
+func Build(inv *metrics.Inventory, opts Options) Dashboard {
+	b := &builder{}
+
+	if _, ok := inv.Family(sloPrefix + "compliance"); ok && len(opts.Objectives) > 0 {
+		b.row("Service level objectives")
+		for _, o := range opts.Objectives {
+			b.sloPanels(o)
+		}
+	}
+
+	// Assign every family to the first section it matches
+	rows := make([][]metrics.Family, len(sections)+1)
+	for _, family := range inv.Families() {
+		if strings.HasPrefix(family.Name, sloPrefix) {
+			continue
+		}
+		i := len(sections)
+		for s, sec := range sections {
+			if hasAnyPrefix(family.Name, sec.prefixes) {
+				i = s
+				break
+			}
+		}
+		rows[i] = append(rows[i], family)
+	}
+	for i, families := range rows {
+		if len(families) == 0 {
+			continue
+		}
+		title := "Other"
+		if i < len(sections) {
+			title = sections[i].title
+		}
+		b.row(title)
+		for _, family := range families {
+			b.familyPanel(family)
+		}
+	}
+
+	return Dashboard{
+		UID:           opts.UID,
+		Title:         opts.Title,
+		Tags:          []string{"llm", "genai", "generated"},
+		Editable:      true,
+		Refresh:       "10s",
+		SchemaVersion: 38,
+		Time:          TimeRange{From: "now-1h", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Datasource", Type: "datasource", Query: "prometheus"},
+			{
+				Name:       "model",
+				Label:      "Model",
+				Type:       "query",
+				Query:      map[string]string{"query": "label_values(model)", "refId": "model"},
+				Datasource: datasource,
+				Refresh:    2,
+				Multi:      true,
+				IncludeAll: true,
+				AllValue:   ".*",
+				Sort:       1,
+			},
+		}},
+		Annotations: map[string]any{"list": []map[string]any{{
+			"builtIn":    1,
+			"datasource": map[string]string{"type": "grafana", "uid": "-- Grafana --"},
+			"enable":     true,
+			"hide":       true,
+			"iconColor":  "rgba(0, 211, 255, 1)",
+			"name":       "Annotations & Alerts",
+			"type":       "dashboard",
+		}}},
+		Panels: b.panels,
+	}
+}
+
+// modelLabel returns the label holding the model name, empty if the family has none
+func modelLabel(f metrics.Family) string {
+	for _, label := range []string{"model", "gen_ai_request_model"} {
+		if f.HasLabel(label) {
+			return label
+		}
+	}
+	return ""
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// familyPanel adds the panel of one metric family: rates for counters,
+// values for gauges and quantiles for histograms
+func (b *builder) familyPanel(f metrics.Family) {
+	selector := f.Name
+	model := modelLabel(f)
+	if model != "" {
+		selector += fmt.Sprintf(`{%s=~"$model"}`, model)
+	}
+	by := strings.Join(f.Labels, ", ")
+
+	panel := Panel{
+		Type:        "timeseries",
+		Title:       f.Name,
+		Description: f.Help,
+		Datasource:  datasource,
+		FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: unit(f)}, Overrides: []any{}},
+		Options: map[string]any{
+			"legend":  map[string]any{"displayMode": "list", "placement": "bottom", "showLegend": true},
+			"tooltip": map[string]any{"mode": "multi", "sort": "desc"},
+		},
+	}
+
+	switch f.Type {
+	case metrics.TypeCounter:
+		panel.Targets = []Target{target("A", fmt.Sprintf("sum by (%s) (rate(%s[$__rate_interval]))", by, selector), legend(f.Labels))}
+	case metrics.TypeHistogram:
+		// Quantiles per model, other labels would multiply the lines. Families
+		// without a model keep up to two labels.
+		group := f.Labels
+		if model != "" {
+			group = []string{model}
+		} else if len(group) > 2 {
+			group = nil
+		}
+		group = append(group[:len(group):len(group)], "le")
+		for i, q := range quantiles {
+			name := fmt.Sprintf("p%g", math.Round(q*1000)/10)
+			panel.Targets = append(panel.Targets, target(string(rune('A'+i)),
+				fmt.Sprintf("histogram_quantile(%g, sum by (%s) (rate(%s_bucket%s[$__rate_interval])))",
+					q, strings.Join(group, ", "), f.Name, strings.TrimPrefix(selector, f.Name)),
+				strings.TrimSpace(legend(group[:len(group)-1])+" "+name)))
+		}
+	default:
+		if len(f.Labels) == 0 {
+			panel.Type = "stat"
+			panel.Options = map[string]any{
+				"colorMode":     "value",
+				"graphMode":     "area",
+				"reduceOptions": map[string]any{"calcs": []string{"lastNotNull"}, "fields": "", "values": false},
+			}
+			panel.Targets = []Target{target("A", selector, "")}
+			b.add(panel, statWidth, panelHeight)
+			return
+		}
+		panel.Targets = []Target{target("A", fmt.Sprintf("sum by (%s) (%s)", by, selector), legend(f.Labels))}
+	}
+	b.add(panel, panelWidth, panelHeight)
+}
+
+// sloPanels adds the compliance, error budget and burn rate of an objective
+func (b *builder) sloPanels(o slo.Objective) {
+	selector := fmt.Sprintf(`{slo=%q}`, o.Name)
+	statOptions := map[string]any{
+		"colorMode":     "background",
+		"graphMode":     "none",
+		"reduceOptions": map[string]any{"calcs": []string{"lastNotNull"}, "fields": "", "values": false},
+	}
+
+	b.add(Panel{
+		Type:        "stat",
+		Title:       o.Name + " compliance",
+		Description: fmt.Sprintf("%s. Target %g%% over %s.", o.Description, o.Target*100, time.Duration(o.Window)),
+		Datasource:  datasource,
+		FieldConfig: &FieldConfig{Defaults: FieldDefaults{
+			Unit:       "percentunit",
+			Color:      map[string]string{"mode": "thresholds"},
+			Thresholds: steps("red", at(o.Target, "green")),
+		}, Overrides: []any{}},
+		Options: statOptions,
+		Targets: []Target{target("A", sloPrefix+"compliance"+selector, "")},
+	}, statWidth, panelHeight)
+
+	b.add(Panel{
+		Type:        "stat",
+		Title:       o.Name + " error budget remaining",
+		Description: "Unspent fraction of the error budget, negative once it is exhausted",
+		Datasource:  datasource,
+		FieldConfig: &FieldConfig{Defaults: FieldDefaults{
+			Unit:       "percentunit",
+			Color:      map[string]string{"mode": "thresholds"},
+			Thresholds: steps("red", at(0, "orange"), at(0.25, "green")),
+		}, Overrides: []any{}},
+		Options: statOptions,
+		Targets: []Target{target("A", sloPrefix+"error_budget_remaining"+selector, "")},
+	}, statWidth, panelHeight)
+
+	b.add(Panel{
+		Type:        "timeseries",
+		Title:       o.Name + " burn rate",
+		Description: "Rate at which the error budget is spent per window, 1 exhausts it at the end of the objective window",
+		Datasource:  datasource,
+		FieldConfig: &FieldConfig{Defaults: FieldDefaults{
+			Thresholds: steps("green", at(1, "orange"), at(6, "red")),
+		}, Overrides: []any{}},
+		Options: map[string]any{
+			"legend":  map[string]any{"displayMode": "list", "placement": "bottom", "showLegend": true},
+			"tooltip": map[string]any{"mode": "multi", "sort": "desc"},
+		},
+		Targets: []Target{target("A", sloPrefix+"burn_rate"+selector, "{{window}}")},
+	}, panelWidth, panelHeight)
+}
+
+// steps builds thresholds starting from the base color
+func steps(base string, next ...Threshold) *Thresholds {
+	return &Thresholds{Mode: "absolute", Steps: append([]Threshold{{Color: base}}, next...)}
+}
+
+// at is the step turning values from value upwards to color
+func at(value float64, color string) Threshold {
+	return Threshold{Color: color, Value: &value}
+}
+
+func target(refID, expr, legendFormat string) Target {
+	return Target{Datasource: datasource, Expr: expr, LegendFormat: legendFormat, RefID: refID}
+}
+
+// legend shows the value of every label
+func legend(labels []string) string {
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = "{{" + label + "}}"
+	}
+	return strings.Join(parts, " ")
+}
+
+// unit picks the Grafana unit from the metric name suffix
+func unit(f metrics.Family) string {
+	name := strings.TrimSuffix(f.Name, "_total")
+	rate := f.Type == metrics.TypeCounter
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		if rate {
+			return "percentunit" // seconds per second
+		}
+		return "s"
+	case strings.HasSuffix(name, "_bytes"):
+		return "bytes"
+	case strings.HasSuffix(name, "_joules"):
+		if rate {
+			return "watt"
+		}
+		return "joule"
+	case strings.HasSuffix(name, "_requests") && rate:
+		return "reqps"
+	}
+	return "short"
+}
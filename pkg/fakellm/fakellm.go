@@ -0,0 +1,464 @@
+// Package fakellm provides a deterministic OpenAI-compatible backend for
+// running the chat and metrics path without a real model.
+package fakellm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule returns a fixed response when the last user message contains Match
+type Rule struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+}
+
+// Config controls the behaviour of the fake backend. It can be loaded from a
+// JSON script file, with time_to_first_token written as a duration string
+// such as "200ms".
+type Config struct {
+	// Model is reported in responses when the request does not name one
+	Model string `json:"model"`
+	// Rules are checked in order before falling back to Responses
+	Rules []Rule `json:"rules"`
+	// Responses are returned round-robin when no rule matches
+	Responses []string `json:"responses"`
+	// TimeToFirstToken delays the first streamed token
+	TimeToFirstToken time.Duration `json:"time_to_first_token"`
+	// TokensPerSecond paces the remaining tokens, 0 streams them without delay
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	// ErrorRate is the fraction of requests answered with ErrorStatus
+	ErrorRate float64 `json:"error_rate"`
+	// ErrorStatus is the status code used for injected errors
+	ErrorStatus int `json:"error_status"`
+	// StreamErrorRate is the fraction of streams cut halfway through their
+	// tokens, without a final chunk
+	StreamErrorRate float64 `json:"stream_error_rate"`
+	// IncludeUsage always sends a usage chunk, even if the client did not ask for one
+	IncludeUsage bool `json:"include_usage"`
+	// EmbeddingDimensions is the length of the vectors returned by /embeddings
+	EmbeddingDimensions int `json:"embedding_dimensions"`
+	// Seed makes error injection reproducible
+	Seed int64 `json:"seed"`
+}
+
+// UnmarshalJSON reads a script, keeping the fields it does not set
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	script := struct {
+		*plain
+		TimeToFirstToken string `json:"time_to_first_token"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return err
+	}
+	if script.TimeToFirstToken != "" {
+		d, err := time.ParseDuration(script.TimeToFirstToken)
+		if err != nil {
+			return fmt.Errorf("invalid time_to_first_token: %w", err)
+		}
+		c.TimeToFirstToken = d
+	}
+	return nil
+}
+
+// DefaultConfig returns a configuration suitable for fast tests
+func DefaultConfig() Config {
+	return Config{
+		Model:               "fake-llm",
+		TimeToFirstToken:    50 * time.Millisecond,
+		TokensPerSecond:     200,
+		ErrorStatus:         http.StatusInternalServerError,
+		EmbeddingDimensions: 8,
+		Seed:                1,
+	}
+}
+
+// Server is an http.Handler serving the OpenAI chat completions, embeddings and models APIs
+type Server struct {
+	cfg Config
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	next     int
+	requests int
+}
+
+// New creates a fake backend with the given configuration
+func New(cfg Config) *Server {
+	if cfg.Model == "" {
+		cfg.Model = "fake-llm"
+	}
+	if cfg.ErrorStatus == 0 {
+		cfg.ErrorStatus = http.StatusInternalServerError
+	}
+	if cfg.EmbeddingDimensions <= 0 {
+		cfg.EmbeddingDimensions = 8
+	}
+
+	return &Server{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Requests returns the number of requests served so far
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// ServeHTTP routes requests by path suffix so the server works under any base path,
+// e.g. /v1 or /engines/llama.cpp/v1
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		s.handleChatCompletions(w, r)
+	case strings.HasSuffix(r.URL.Path, "/embeddings"):
+		s.handleEmbeddings(w, r)
+	case strings.HasSuffix(r.URL.Path, "/models"):
+		s.handleModels(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "unknown path "+r.URL.Path)
+	}
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message content, which may be a string or an array of text parts
+func (m chatMessage) text() string {
+	var content string
+	if err := json.Unmarshal(m.Content, &content); err == nil {
+		return content
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(m.Content, &parts)
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(part.Text)
+	}
+	return b.String()
+}
+
+type chatRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body")
+		return
+	}
+
+	if s.shouldFail() {
+		writeError(w, s.cfg.ErrorStatus, "server_error", "injected error")
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = s.cfg.Model
+	}
+
+	tokens := Tokenize(s.respond(lastUserMessage(req.Messages)))
+	promptTokens := 0
+	for _, msg := range req.Messages {
+		promptTokens += len(msg.text()) / 4
+	}
+	u := usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: len(tokens),
+		TotalTokens:      promptTokens + len(tokens),
+	}
+
+	id := fmt.Sprintf("chatcmpl-fake-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+
+	if !req.Stream {
+		if !sleep(r, s.cfg.TimeToFirstToken+s.generationTime(len(tokens))) {
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": strings.Join(tokens, "")},
+				"finish_reason": "stop",
+				"logprobs":      nil,
+			}},
+			"usage": u,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	send := func(payload interface{}) {
+		data, _ := json.Marshal(payload)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta map[string]string, finishReason interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finishReason,
+				"logprobs":      nil,
+			}},
+		}
+	}
+
+	if !sleep(r, s.cfg.TimeToFirstToken) {
+		return
+	}
+	send(chunk(map[string]string{"role": "assistant"}, nil))
+
+	cutAt := -1
+	if s.shouldCut() {
+		cutAt = len(tokens) / 2
+	}
+	interval := s.generationTime(1)
+	for i, token := range tokens {
+		if i == cutAt {
+			// Aborting closes the connection without ending the chunked
+			// body, so the client reads an unexpected EOF
+			panic(http.ErrAbortHandler)
+		}
+		if i > 0 && !sleep(r, interval) {
+			return
+		}
+		send(chunk(map[string]string{"content": token}, nil))
+	}
+	send(chunk(map[string]string{}, "stop"))
+
+	if s.cfg.IncludeUsage || (req.StreamOptions != nil && req.StreamOptions.IncludeUsage) {
+		send(map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []interface{}{},
+			"usage":   u,
+		})
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+
+	var req struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body")
+		return
+	}
+
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(req.Input, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(req.Input, &inputs); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "input must be a string or an array of strings")
+		return
+	}
+
+	if s.shouldFail() {
+		writeError(w, s.cfg.ErrorStatus, "server_error", "injected error")
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = s.cfg.Model
+	}
+
+	data := make([]map[string]interface{}, 0, len(inputs))
+	promptTokens := 0
+	for i, input := range inputs {
+		promptTokens += len(input) / 4
+		data = append(data, map[string]interface{}{
+			"object":    "embedding",
+			"index":     i,
+			"embedding": Embed(input, s.cfg.EmbeddingDimensions),
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"object": "list",
+		"model":  model,
+		"data":   data,
+		"usage": map[string]int{
+			"prompt_tokens": promptTokens,
+			"total_tokens":  promptTokens,
+		},
+	})
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{{
+			"id":       s.cfg.Model,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "fakellm",
+		}},
+	})
+}
+
+// respond picks the scripted response for a prompt
+func (s *Server) respond(prompt string) string {
+	for _, rule := range s.cfg.Rules {
+		if strings.Contains(strings.ToLower(prompt), strings.ToLower(rule.Match)) {
+			return rule.Response
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cfg.Responses) == 0 {
+		return "This is a fake response to: " + prompt
+	}
+	response := s.cfg.Responses[s.next%len(s.cfg.Responses)]
+	s.next++
+	return response
+}
+
+// shouldFail counts the request and decides whether to inject an error
+func (s *Server) shouldFail() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	return s.cfg.ErrorRate > 0 && s.rng.Float64() < s.cfg.ErrorRate
+}
+
+// shouldCut decides whether to cut a stream halfway
+func (s *Server) shouldCut() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.StreamErrorRate > 0 && s.rng.Float64() < s.cfg.StreamErrorRate
+}
+
+// generationTime returns how long generating n tokens takes at the configured rate
+func (s *Server) generationTime(n int) time.Duration {
+	if s.cfg.TokensPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / s.cfg.TokensPerSecond * float64(time.Second))
+}
+
+// Tokenize splits text into word tokens, keeping the separating whitespace
+// so that joining the tokens reproduces the text
+func Tokenize(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.SplitAfter(text, " ")
+}
+
+// Embed returns a deterministic vector derived from the input
+func Embed(input string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	for i, c := range input {
+		vector[i%dimensions] += float64(c%32) / 32
+	}
+	return vector
+}
+
+func lastUserMessage(messages []chatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		if text := messages[i].text(); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// sleep waits for d or until the client goes away, reporting whether to continue
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    nil,
+		},
+	})
+}
@@ -0,0 +1,177 @@
+package fakellm
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromScript(t *testing.T) {
+	cfg := DefaultConfig()
+	script := `{
+		"model": "scripted",
+		"time_to_first_token": "300ms",
+		"tokens_per_second": 20,
+		"error_rate": 0.1,
+		"stream_error_rate": 0.05,
+		"responses": ["Hello!"]
+	}`
+	if err := json.Unmarshal([]byte(script), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultConfig()
+	want.Model = "scripted"
+	want.TimeToFirstToken = 300 * time.Millisecond
+	want.TokensPerSecond = 20
+	want.ErrorRate = 0.1
+	want.StreamErrorRate = 0.05
+	want.Responses = []string{"Hello!"}
+	if cfg.Model != want.Model || cfg.TimeToFirstToken != want.TimeToFirstToken ||
+		cfg.TokensPerSecond != want.TokensPerSecond || cfg.ErrorRate != want.ErrorRate ||
+		cfg.StreamErrorRate != want.StreamErrorRate || cfg.ErrorStatus != want.ErrorStatus ||
+		cfg.Seed != want.Seed || len(cfg.Responses) != 1 {
+		t.Errorf("config = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestConfigFromScriptInvalidDuration(t *testing.T) {
+	for _, script := range []string{
+		`{"time_to_first_token": "soon"}`,
+		`{"time_to_first_token": 300}`,
+	} {
+		cfg := DefaultConfig()
+		if err := json.Unmarshal([]byte(script), &cfg); err == nil {
+			t.Errorf("%s: no error", script)
+		}
+	}
+}
+
+// chat sends a chat completion request to a fake with cfg and returns the response
+func chat(t *testing.T, cfg Config, body string) *http.Response {
+	t.Helper()
+	server := httptest.NewServer(New(cfg))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func fastConfig() Config {
+	cfg := DefaultConfig()
+	cfg.TimeToFirstToken = 0
+	cfg.TokensPerSecond = 0
+	cfg.Rules = []Rule{{Match: "docker", Response: "Docker packages applications into containers."}}
+	return cfg
+}
+
+const streamRequest = `{"stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "What is Docker?"}]}`
+
+func TestChatCompletionsStream(t *testing.T) {
+	resp := chat(t, fastConfig(), streamRequest)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content strings.Builder
+	var finished, usageMatches, done bool
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta        struct{ Content string }
+				FinishReason *string `json:"finish_reason"`
+			}
+			Usage *usage
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		for _, c := range chunk.Choices {
+			content.WriteString(c.Delta.Content)
+			finished = finished || c.FinishReason != nil
+		}
+		if chunk.Usage != nil {
+			usageMatches = chunk.Usage.CompletionTokens == len(Tokenize(content.String()))
+		}
+	}
+
+	if got, want := content.String(), "Docker packages applications into containers."; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	if !finished || !usageMatches || !done {
+		t.Errorf("finish reason %v, matching usage %v, [DONE] %v, want all", finished, usageMatches, done)
+	}
+}
+
+func TestChatCompletionsErrorRate(t *testing.T) {
+	cfg := fastConfig()
+	cfg.ErrorRate = 1
+	cfg.ErrorStatus = http.StatusServiceUnavailable
+
+	resp := chat(t, cfg, streamRequest)
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestChatCompletionsStreamErrorRate(t *testing.T) {
+	cfg := fastConfig()
+	cfg.StreamErrorRate = 1
+
+	resp := chat(t, cfg, streamRequest)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200 before the cut", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading the body returned %v, want an unexpected EOF", err)
+	}
+	if !strings.Contains(string(body), `"role":"assistant"`) {
+		t.Error("stream cut before the first chunk")
+	}
+	if strings.Contains(string(body), "[DONE]") || strings.Contains(string(body), `"finish_reason":"stop"`) {
+		t.Error("cut stream was completed")
+	}
+}
+
+func TestRespond(t *testing.T) {
+	s := New(Config{
+		Rules:     []Rule{{Match: "2 + 2", Response: "4"}},
+		Responses: []string{"a", "b"},
+	})
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"What is 2 + 2?", "4"},
+		{"Hi", "a"},
+		{"Hi", "b"},
+		{"Hi", "a"},
+	}
+	for _, tt := range tests {
+		if got := s.respond(tt.prompt); got != tt.want {
+			t.Errorf("respond(%q) = %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+}
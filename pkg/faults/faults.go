@@ -0,0 +1,281 @@
+// Package faults injects failures into the chat path so dashboards and
+// alerts can be exercised without breaking the model backend.
+package faults
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Fault types
+const (
+	TypeLatency         = "latency"
+	TypeDropStream      = "drop_stream"
+	TypeUpstream5xx     = "upstream_5xx"
+	TypeStallFirstToken = "stall_first_token"
+)
+
+// ErrStreamDropped is returned from writes after an injected stream drop
+var ErrStreamDropped = errors.New("stream dropped by fault injection")
+
+// Fault describes one kind of failure and how often it is injected
+type Fault struct {
+	Type string `json:"type"`
+	// Percentage of requests affected, 0-100
+	Percentage float64 `json:"percentage"`
+	// DelayMs is used by latency and stall_first_token
+	DelayMs int `json:"delay_ms,omitempty"`
+	// AfterChunks is the number of chunks written before drop_stream cuts the response
+	AfterChunks int `json:"after_chunks,omitempty"`
+	// StatusCode is returned by upstream_5xx, defaults to 502
+	StatusCode int `json:"status_code,omitempty"`
+}
+
+// Config is the fault injection configuration managed through the admin endpoint
+type Config struct {
+	Enabled bool    `json:"enabled"`
+	Faults  []Fault `json:"faults"`
+}
+
+// Validate checks that every fault is known and has sensible parameters
+func (c Config) Validate() error {
+	for _, f := range c.Faults {
+		if f.Percentage < 0 || f.Percentage > 100 {
+			return fmt.Errorf("fault %s: percentage must be between 0 and 100", f.Type)
+		}
+		switch f.Type {
+		case TypeLatency, TypeStallFirstToken:
+			if f.DelayMs <= 0 {
+				return fmt.Errorf("fault %s: delay_ms must be positive", f.Type)
+			}
+		case TypeDropStream:
+			if f.AfterChunks < 0 {
+				return fmt.Errorf("fault %s: after_chunks must not be negative", f.Type)
+			}
+		case TypeUpstream5xx:
+			if f.StatusCode != 0 && (f.StatusCode < 500 || f.StatusCode > 599) {
+				return fmt.Errorf("fault %s: status_code must be a 5xx code", f.Type)
+			}
+		default:
+			return fmt.Errorf("unknown fault type %q", f.Type)
+		}
+	}
+	return nil
+}
+
+// Injector applies the configured faults to requests
+type Injector struct {
+	rec *metrics.Recorder
+
+	mu     sync.RWMutex
+	config Config
+	rng    *rand.Rand
+}
+
+// NewInjector creates a disabled injector that counts injected faults in rec
+func NewInjector(rec *metrics.Recorder) *Injector {
+	return &Injector{
+		rec: rec,
+		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Config returns the current configuration
+func (i *Injector) Config() Config {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.config
+}
+
+// SetConfig replaces the current configuration
+func (i *Injector) SetConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	i.config = cfg
+	i.mu.Unlock()
+	log.Info().Bool("enabled", cfg.Enabled).Int("faults", len(cfg.Faults)).Msg("Fault injection updated")
+	return nil
+}
+
+// pick returns the faults selected for a single request
+func (i *Injector) pick() []Fault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.config.Enabled {
+		return nil
+	}
+
+	var selected []Fault
+	for _, f := range i.config.Faults {
+		if i.rng.Float64()*100 < f.Percentage {
+			selected = append(selected, f)
+		}
+	}
+	return selected
+}
+
+// record counts an injected fault and adds it to the request span
+func (i *Injector) record(ctx context.Context, f Fault) {
+	i.rec.InjectedFaults.WithLabelValues(f.Type).Inc()
+	tracing.CreateEvent(ctx, "fault_injected", attribute.String("fault.type", f.Type))
+}
+
+// Middleware injects the selected faults into the wrapped handler
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests are never faulted
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		selected := i.pick()
+		if len(selected) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		fw := &faultWriter{w: w, ctx: ctx, cancel: cancel, dropAfter: -1}
+		for _, f := range selected {
+			switch f.Type {
+			case TypeLatency:
+				i.record(ctx, f)
+				select {
+				case <-time.After(time.Duration(f.DelayMs) * time.Millisecond):
+				case <-ctx.Done():
+					return
+				}
+			case TypeUpstream5xx:
+				i.record(ctx, f)
+				status := f.StatusCode
+				if status == 0 {
+					status = http.StatusBadGateway
+				}
+				// The failure never reaches the handler, so it is classified here
+				i.rec.RecordError(r.URL.Path, metrics.ErrorInjectedUpstream5xx)
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				http.Error(w, "Injected upstream error", status)
+				return
+			case TypeStallFirstToken:
+				i.record(ctx, f)
+				fw.stall = time.Duration(f.DelayMs) * time.Millisecond
+			case TypeDropStream:
+				i.record(ctx, f)
+				fw.dropAfter = f.AfterChunks
+			}
+		}
+
+		next.ServeHTTP(fw, r.WithContext(ctx))
+	})
+}
+
+// faultWriter delays the first write and cuts the stream after a number of writes
+type faultWriter struct {
+	w         http.ResponseWriter
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stall     time.Duration
+	dropAfter int
+	writes    int
+	dropped   bool
+}
+
+// Header returns the header map from the wrapped response writer
+func (fw *faultWriter) Header() http.Header {
+	return fw.w.Header()
+}
+
+// WriteHeader writes the header to the wrapped response writer
+func (fw *faultWriter) WriteHeader(statusCode int) {
+	fw.w.WriteHeader(statusCode)
+}
+
+// Write applies the stall and drop faults before writing to the wrapped response writer
+func (fw *faultWriter) Write(b []byte) (int, error) {
+	if fw.dropped {
+		return 0, ErrStreamDropped
+	}
+
+	if fw.writes == 0 && fw.stall > 0 {
+		timer := time.NewTimer(fw.stall)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-fw.ctx.Done():
+			return 0, fw.ctx.Err()
+		}
+	}
+
+	if fw.dropAfter >= 0 && fw.writes >= fw.dropAfter {
+		// Cancelling the context closes the upstream stream like a disconnecting client
+		fw.dropped = true
+		fw.cancel()
+		return 0, ErrStreamDropped
+	}
+
+	fw.writes++
+	return fw.w.Write(b)
+}
+
+// Flush implements the http.Flusher interface
+func (fw *faultWriter) Flush() {
+	if fw.dropped {
+		return
+	}
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// HandleAdmin serves the fault injection configuration. GET returns it, PUT or POST
+// replaces it and DELETE disables injection. Requests must carry token as a
+// bearer token, an empty token rejects every request.
+func (i *Injector) HandleAdmin(token string) http.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var cfg Config
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := i.SetConfig(cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			i.SetConfig(Config{})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(i.Config())
+	}
+}
@@ -2,6 +2,7 @@ package health
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime"
 	"time"
@@ -27,8 +28,8 @@ var (
 	version   = "1.0.0" // Should be set during build
 )
 
-// HandleHealth returns a simple health check handler
-func HandleHealth() http.HandlerFunc {
+// HandleHealth returns a simple health check handler reporting metrics from rec
+func HandleHealth(rec *metrics.Recorder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Create health status
 		status := &Status{
@@ -46,7 +47,7 @@ func HandleHealth() http.HandlerFunc {
 		status.MemStats = memStats
 
 		// Include some basic metrics
-		status.Metrics["active_requests"] = fmt.Sprintf("%v", metrics.ActiveRequests)
+		status.Metrics["active_requests"] = fmt.Sprintf("%v", rec.ActiveRequestCount())
 
 		// Send response
 		w.Header().Set("Content-Type", "application/json")
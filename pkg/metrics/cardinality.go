@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OtherLabelValue replaces the label values of a metric that reached its series limit
+const OtherLabelValue = "other"
+
+// DefaultSeriesLimit is the number of label value combinations allowed per metric
+const DefaultSeriesLimit = 500
+
+// LabelGuard caps the series of metrics whose label values come from requests,
+// such as paths, methods or model names. Once a metric has limit distinct label
+// value combinations, new combinations are recorded as "other" and counted in
+// genai_app_dropped_label_values_total.
+type LabelGuard struct {
+	dropped *prometheus.CounterVec
+
+	mu     sync.Mutex
+	limit  int
+	series map[string]map[string]struct{}
+}
+
+// NewLabelGuard creates a guard allowing limit series per metric, 0 disables the cap
+func NewLabelGuard(limit int, dropped *prometheus.CounterVec) *LabelGuard {
+	return &LabelGuard{
+		dropped: dropped,
+		limit:   limit,
+		series:  make(map[string]map[string]struct{}),
+	}
+}
+
+// SetLimit changes the number of series allowed per metric. Series already
+// seen are kept.
+func (g *LabelGuard) SetLimit(limit int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limit = limit
+}
+
+// Values returns the label values to record for metric: values itself when the
+// series exists or fits under the limit, otherwise "other" for every label
+func (g *LabelGuard) Values(metric string, values ...string) []string {
+	key := strings.Join(values, "\xff")
+
+	g.mu.Lock()
+	seen, ok := g.series[metric]
+	if !ok {
+		seen = make(map[string]struct{})
+		g.series[metric] = seen
+	}
+	if _, ok := seen[key]; ok || g.limit <= 0 || len(seen) < g.limit {
+		seen[key] = struct{}{}
+		g.mu.Unlock()
+		return values
+	}
+	g.mu.Unlock()
+
+	g.dropped.WithLabelValues(metric).Inc()
+	other := make([]string, len(values))
+	for i := range other {
+		other[i] = OtherLabelValue
+	}
+	return other
+}
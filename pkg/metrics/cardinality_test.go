@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestGuard(limit int) (*LabelGuard, *prometheus.CounterVec) {
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped_total"}, []string{"metric"})
+	return NewLabelGuard(limit, dropped), dropped
+}
+
+func TestLabelGuardCap(t *testing.T) {
+	guard, dropped := newTestGuard(3)
+	other := []string{OtherLabelValue, OtherLabelValue}
+
+	tests := []struct {
+		metric string
+		values []string
+		want   []string
+	}{
+		{"a", []string{"GET", "/1"}, []string{"GET", "/1"}},
+		{"a", []string{"GET", "/2"}, []string{"GET", "/2"}},
+		// The third series reaches the cap and is still kept
+		{"a", []string{"GET", "/3"}, []string{"GET", "/3"}},
+		// Past the cap, new series go to the overflow bucket
+		{"a", []string{"GET", "/4"}, other},
+		{"a", []string{"POST", "/1"}, other},
+		// Series seen before the cap keep their values
+		{"a", []string{"GET", "/1"}, []string{"GET", "/1"}},
+		// Every metric has its own cap
+		{"b", []string{"GET", "/4"}, []string{"GET", "/4"}},
+		// Values are compared as a whole, not concatenated
+		{"b", []string{"GET/", "4"}, []string{"GET/", "4"}},
+	}
+	for _, tt := range tests {
+		if got := guard.Values(tt.metric, tt.values...); !slices.Equal(got, tt.want) {
+			t.Errorf("Values(%s, %v) = %v, want %v", tt.metric, tt.values, got, tt.want)
+		}
+	}
+
+	if got := testutil.ToFloat64(dropped.WithLabelValues("a")); got != 2 {
+		t.Errorf("dropped for a = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(dropped); got != 1 {
+		t.Errorf("dropped series = %d, want 1", got)
+	}
+}
+
+func TestLabelGuardLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		kept  int
+	}{
+		{"disabled", 0, 1000},
+		{"one", 1, 1},
+		{"default", DefaultSeriesLimit, DefaultSeriesLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, dropped := newTestGuard(tt.limit)
+			kept := 0
+			for i := 0; i < 1000; i++ {
+				if v := guard.Values("m", fmt.Sprint(i)); v[0] != OtherLabelValue {
+					kept++
+				}
+			}
+			if kept != tt.kept {
+				t.Errorf("kept %d series, want %d", kept, tt.kept)
+			}
+			if got := testutil.ToFloat64(dropped.WithLabelValues("m")); got != float64(1000-tt.kept) {
+				t.Errorf("dropped = %v, want %d", got, 1000-tt.kept)
+			}
+		})
+	}
+}
+
+func TestLabelGuardSetLimit(t *testing.T) {
+	guard, _ := newTestGuard(1)
+	guard.Values("m", "a")
+	if got := guard.Values("m", "b"); got[0] != OtherLabelValue {
+		t.Fatalf("second series under a limit of 1 = %v, want other", got)
+	}
+
+	guard.SetLimit(2)
+	if got := guard.Values("m", "b"); got[0] != "b" {
+		t.Errorf("second series after raising the limit = %v, want b", got)
+	}
+	guard.SetLimit(1)
+	if got := guard.Values("m", "b"); got[0] != "b" {
+		t.Errorf("series seen before lowering the limit = %v, want b", got)
+	}
+}
+
+// Recorder metrics fed from requests go through the guard
+func TestRecorderCapsRequestLabels(t *testing.T) {
+	rec := NewRecorder(prometheus.NewRegistry())
+	rec.Labels.SetLimit(2)
+	for i := 0; i < 5; i++ {
+		rec.RecordError(fmt.Sprintf("/scan/%d", i), ErrorInternal)
+	}
+
+	if got := testutil.CollectAndCount(rec.ErrorCounter); got != 3 {
+		t.Errorf("error series = %d, want 2 and the overflow series", got)
+	}
+	if got := testutil.ToFloat64(rec.ErrorCounter.WithLabelValues(OtherLabelValue, OtherLabelValue)); got != 3 {
+		t.Errorf("overflow errors = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(rec.DroppedLabelValues.WithLabelValues("genai_app_errors_total")); got != 3 {
+		t.Errorf("dropped label values = %v, want 3", got)
+	}
+}
@@ -0,0 +1,45 @@
+package metrics
+
+// Error types recorded in genai_app_errors_total. Every server-side failure is
+// classified into exactly one of them.
+const (
+	// ErrorClientInput is a request the server rejected, such as a malformed body
+	ErrorClientInput = "client_input"
+	// ErrorUpstreamTimeout is a model backend call that timed out
+	ErrorUpstreamTimeout = "upstream_timeout"
+	// ErrorUpstream5xx is a model backend call that failed with a 5xx status
+	ErrorUpstream5xx = "upstream_5xx"
+	// ErrorStreamInterrupted is a response stream cut before completion, by the
+	// client disconnecting or the backend closing the stream early
+	ErrorStreamInterrupted = "stream_interrupted"
+	// ErrorRateLimited is a request rejected by a rate limit, locally or upstream
+	ErrorRateLimited = "rate_limited"
+	// ErrorInternal is any other failure
+	ErrorInternal = "internal"
+
+	// Failures caused by the fault injector keep their own types, so chaos
+	// runs can be told apart from outages
+
+	// ErrorInjectedUpstream5xx is a 5xx returned by the fault injector
+	ErrorInjectedUpstream5xx = "injected_upstream_5xx"
+	// ErrorInjectedStreamInterrupted is a stream cut by the fault injector
+	ErrorInjectedStreamInterrupted = "injected_stream_interrupted"
+)
+
+// ChatEndpoint is the endpoint label of chat requests
+const ChatEndpoint = "/chat"
+
+// RecordError counts a classified error for endpoint
+func (r *Recorder) RecordError(endpoint, errorType string) {
+	r.ErrorCounter.WithLabelValues(r.Labels.Values("genai_app_errors_total", errorType, endpoint)...).Inc()
+}
+
+// ChatErrorRate returns the ratio of chat errors to chat requests. Scrapes,
+// preflights and other endpoints are left out of both sides.
+func (r *Recorder) ChatErrorRate() float64 {
+	requests := counterSum(r.RequestCounter, map[string]string{"method": "POST", "endpoint": ChatEndpoint})
+	if requests == 0 {
+		return 0.0
+	}
+	return counterSum(r.ErrorCounter, map[string]string{"endpoint": ChatEndpoint}) / requests
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ObserveWithTrace observes v and, when ctx carries a sampled span, attaches its
+// trace ID as an exemplar so dashboards can jump from a bucket to the trace.
+// Exemplars are only exposed by handlers with OpenMetrics enabled.
+func ObserveWithTrace(ctx context.Context, observer prometheus.Observer, v float64) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.IsSampled() {
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplarObserver.ObserveWithExemplar(v, prometheus.Labels{"trace_id": spanContext.TraceID().String()})
+			return
+		}
+	}
+	observer.Observe(v)
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import "time"
+
+// GenAIOperation is one call to the model backend, described with the
+// OpenTelemetry GenAI semantic conventions
+type GenAIOperation struct {
+	Operation     string // chat or embeddings
+	System        string
+	RequestModel  string
+	ResponseModel string
+	InputTokens   int
+	OutputTokens  int
+	Duration      time.Duration
+	// ErrorType is empty when the operation succeeded
+	ErrorType string
+	// UsageEstimated is set when the backend did not report its token usage
+	// and the token counts are estimates
+	UsageEstimated bool
+}
+
+// RecordGenAIOperation records gen_ai.client.operation.duration and, for
+// successful operations, gen_ai.client.token.usage
+func (r *Recorder) RecordGenAIOperation(op GenAIOperation) {
+	responseModel := op.ResponseModel
+	if responseModel == "" {
+		responseModel = op.RequestModel
+	}
+
+	// Request models can be chosen by API callers, so both metrics are guarded
+	durationLabels := r.Labels.Values("gen_ai_client_operation_duration_seconds", op.Operation, op.System, op.RequestModel, responseModel, op.ErrorType)
+	r.GenAIOperationDuration.WithLabelValues(durationLabels...).Observe(op.Duration.Seconds())
+	if op.ErrorType != "" {
+		return
+	}
+
+	if op.UsageEstimated {
+		r.GenAIUsageEstimated.WithLabelValues(op.Operation).Inc()
+	}
+	inputLabels := r.Labels.Values("gen_ai_client_token_usage", op.Operation, op.System, op.RequestModel, responseModel, "input")
+	r.GenAITokenUsage.WithLabelValues(inputLabels...).Observe(float64(op.InputTokens))
+	if op.Operation != "embeddings" {
+		outputLabels := r.Labels.Values("gen_ai_client_token_usage", op.Operation, op.System, op.RequestModel, responseModel, "output")
+		r.GenAITokenUsage.WithLabelValues(outputLabels...).Observe(float64(op.OutputTokens))
+	}
+}
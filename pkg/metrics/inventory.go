@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric types of a Family
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+// Family describes a metric family registered by the application
+type Family struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+// HasLabel reports whether the family is labelled with name
+func (f Family) HasLabel(name string) bool {
+	for _, label := range f.Labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Desc returns a descriptor for the family, for collectors that build their
+// own metrics
+func (f Family) Desc() *prometheus.Desc {
+	return prometheus.NewDesc(f.Name, f.Help, f.Labels, nil)
+}
+
+// FamilyDescriber is implemented by custom collectors to list the families
+// they report, which an Inventory cannot read back from their descriptors
+type FamilyDescriber interface {
+	Families() []Family
+}
+
+// Inventory is a prometheus.Registerer that records the families of the
+// collectors registered with it instead of serving them. Rules and dashboards
+// are generated from it so they follow the metrics the code defines.
+//
+// Collectors must either be created with a Factory, which declares their
+// family from the options it was given, or implement FamilyDescriber.
+type Inventory struct {
+	families map[string]Family
+}
+
+// NewInventory creates an empty inventory
+func NewInventory() *Inventory {
+	return &Inventory{families: make(map[string]Family)}
+}
+
+// Register records the families of c
+func (i *Inventory) Register(c prometheus.Collector) error {
+	d, ok := c.(FamilyDescriber)
+	if !ok {
+		return fmt.Errorf("collector %T does not declare its metric families", c)
+	}
+	return i.add(d.Families()...)
+}
+
+// add records families, or none of them if one is already recorded
+func (i *Inventory) add(families ...Family) error {
+	for _, family := range families {
+		if _, ok := i.families[family.Name]; ok {
+			return prometheus.AlreadyRegisteredError{}
+		}
+	}
+	for _, family := range families {
+		i.families[family.Name] = family
+	}
+	return nil
+}
+
+// MustRegister records the collectors and panics on errors
+func (i *Inventory) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := i.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister is a no-op, inventories only grow
+func (i *Inventory) Unregister(prometheus.Collector) bool {
+	return false
+}
+
+// Family returns the family called name
+func (i *Inventory) Family(name string) (Family, bool) {
+	family, ok := i.families[name]
+	return family, ok
+}
+
+// Families returns every family sorted by name
+func (i *Inventory) Families() []Family {
+	families := make([]Family, 0, len(i.families))
+	for _, family := range i.families {
+		families = append(families, family)
+	}
+	sort.Slice(families, func(a, b int) bool { return families[a].Name < families[b].Name })
+	return families
+}
+
+// Factory creates metrics and registers them like promauto.Factory. When the
+// registerer is an Inventory, it records the family of every metric from its
+// options instead.
+type Factory struct {
+	reg prometheus.Registerer
+}
+
+// With returns a Factory registering with reg
+func With(reg prometheus.Registerer) Factory {
+	return Factory{reg: reg}
+}
+
+// NewCounterVec works like prometheus.NewCounterVec
+func (f Factory) NewCounterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labels)
+	f.register(c, prometheus.Opts(opts), TypeCounter, labels)
+	return c
+}
+
+// NewGauge works like prometheus.NewGauge
+func (f Factory) NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	g := prometheus.NewGauge(opts)
+	f.register(g, prometheus.Opts(opts), TypeGauge, nil)
+	return g
+}
+
+// NewGaugeVec works like prometheus.NewGaugeVec
+func (f Factory) NewGaugeVec(opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(opts, labels)
+	f.register(g, prometheus.Opts(opts), TypeGauge, labels)
+	return g
+}
+
+// NewHistogramVec works like prometheus.NewHistogramVec
+func (f Factory) NewHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(opts, labels)
+	f.register(h, prometheus.Opts{
+		Namespace: opts.Namespace,
+		Subsystem: opts.Subsystem,
+		Name:      opts.Name,
+		Help:      opts.Help,
+	}, TypeHistogram, labels)
+	return h
+}
+
+func (f Factory) register(c prometheus.Collector, opts prometheus.Opts, typ string, labels []string) {
+	if inv, ok := f.reg.(*Inventory); ok {
+		if err := inv.add(Family{
+			Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			Help:   opts.Help,
+			Type:   typ,
+			Labels: labels,
+		}); err != nil {
+			panic(err)
+		}
+		return
+	}
+	f.reg.MustRegister(c)
+}
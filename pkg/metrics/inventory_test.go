@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type describedCollector struct{ families []Family }
+
+func (c describedCollector) Families() []Family                  { return c.families }
+func (c describedCollector) Describe(ch chan<- *prometheus.Desc) {}
+func (c describedCollector) Collect(ch chan<- prometheus.Metric) {}
+
+func TestInventoryFamilies(t *testing.T) {
+	inv := NewInventory()
+	factory := With(inv)
+	factory.NewCounterVec(prometheus.CounterOpts{Namespace: "app", Name: "requests_total", Help: "Requests"}, []string{"route"})
+	factory.NewGauge(prometheus.GaugeOpts{Name: "app_active", Help: "Active"})
+	factory.NewGaugeVec(prometheus.GaugeOpts{Name: "app_queue", Help: "Queue"}, []string{"model"})
+	factory.NewHistogramVec(prometheus.HistogramOpts{Subsystem: "app", Name: "seconds", Help: "Latency"}, []string{"model", "operation"})
+	inv.MustRegister(describedCollector{[]Family{{Name: "app_custom", Help: "Custom", Type: TypeGauge, Labels: []string{"slo"}}}})
+
+	want := []Family{
+		{Name: "app_active", Help: "Active", Type: TypeGauge},
+		{Name: "app_custom", Help: "Custom", Type: TypeGauge, Labels: []string{"slo"}},
+		{Name: "app_queue", Help: "Queue", Type: TypeGauge, Labels: []string{"model"}},
+		{Name: "app_requests_total", Help: "Requests", Type: TypeCounter, Labels: []string{"route"}},
+		{Name: "app_seconds", Help: "Latency", Type: TypeHistogram, Labels: []string{"model", "operation"}},
+	}
+	got := inv.Families()
+	if len(got) != len(want) {
+		t.Fatalf("got %d families, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].Help != want[i].Help || got[i].Type != want[i].Type || !slices.Equal(got[i].Labels, want[i].Labels) {
+			t.Errorf("family %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestInventoryRejects(t *testing.T) {
+	inv := NewInventory()
+	With(inv).NewGauge(prometheus.GaugeOpts{Name: "app_active", Help: "Active"})
+
+	if err := inv.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "app_other"})); err == nil {
+		t.Error("collector without declared families accepted")
+	}
+	err := inv.Register(describedCollector{[]Family{{Name: "app_new"}, {Name: "app_active"}}})
+	if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		t.Errorf("registering a family twice returned %v, want AlreadyRegisteredError", err)
+	}
+	if _, ok := inv.Family("app_new"); ok {
+		t.Error("families of a rejected collector recorded")
+	}
+}
+
+// The inventory follows the metrics the Recorder serves
+func TestInventoryMatchesRecorder(t *testing.T) {
+	inv := NewInventory()
+	NewRecorder(inv)
+	reg := prometheus.NewRegistry()
+	rec := NewRecorder(reg)
+	rec.ActiveRequests.Set(1)
+
+	family, ok := inv.Family("genai_app_active_requests")
+	if !ok || family.Type != TypeGauge {
+		t.Fatalf("active requests family = %+v, %v, want a gauge", family, ok)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if _, ok := inv.Family(mf.GetName()); !ok {
+			t.Errorf("served family %s missing from the inventory", mf.GetName())
+		}
+	}
+}
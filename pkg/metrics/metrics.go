@@ -5,13 +5,88 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
-	// RequestCounter counts total HTTP requests
-	RequestCounter = promauto.NewCounterVec(
+// Recorder owns every application metric. It is constructed with a
+// prometheus.Registerer so that the server and tests can use isolated registries.
+type Recorder struct {
+	// HTTP metrics
+	RequestCounter  *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+	ActiveRequests  prometheus.Gauge
+	ErrorCounter    *prometheus.CounterVec
+
+	// FrontendErrorCounter counts errors reported by the frontend
+	FrontendErrorCounter *prometheus.CounterVec
+	// InjectedFaults counts faults applied by the fault injector
+	InjectedFaults *prometheus.CounterVec
+
+	// Frontend telemetry ingestion metrics
+	TelemetryReports *prometheus.CounterVec
+	ClientLatency    *prometheus.HistogramVec
+	ClientOverhead   *prometheus.HistogramVec
+
+	// Model metrics
+	ChatTokensCounter *prometheus.CounterVec
+	ModelLatency      *prometheus.HistogramVec
+	FirstTokenLatency *prometheus.HistogramVec
+
+	// GenAI semantic convention metrics
+	GenAITokenUsage        *prometheus.HistogramVec
+	GenAIOperationDuration *prometheus.HistogramVec
+	// GenAIUsageEstimated counts operations whose token usage was estimated
+	GenAIUsageEstimated *prometheus.CounterVec
+
+	// Streaming smoothness metrics
+	InterTokenLatency *prometheus.HistogramVec
+	StreamJitter      *prometheus.HistogramVec
+	TokenStalls       *prometheus.CounterVec
+
+	// llama.cpp metrics
+	LlamaCppContextSize     *prometheus.GaugeVec
+	LlamaCppPromptEvalTime  *prometheus.HistogramVec
+	LlamaCppTokensPerSecond *prometheus.GaugeVec
+	LlamaCppMemoryPerToken  *prometheus.GaugeVec
+	LlamaCppThreadsUsed     *prometheus.GaugeVec
+	LlamaCppBatchSize       *prometheus.GaugeVec
+
+	// Embedding metrics
+	EmbeddingLatency    *prometheus.HistogramVec
+	EmbeddingBatchSize  *prometheus.HistogramVec
+	EmbeddingDimensions *prometheus.GaugeVec
+
+	// Upstream (model backend) client metrics
+	UpstreamPhaseDuration   *prometheus.HistogramVec
+	UpstreamRequestDuration *prometheus.HistogramVec
+	UpstreamRequests        *prometheus.CounterVec
+	UpstreamRetries         *prometheus.CounterVec
+
+	// Cost and energy estimates
+	CostCounter   *prometheus.CounterVec
+	EnergyCounter *prometheus.CounterVec
+
+	// ChatWindow keeps recent chat outcomes for windowed summaries
+	ChatWindow *WindowStore
+
+	// Labels caps the series of metrics labelled with request-supplied values
+	Labels             *LabelGuard
+	DroppedLabelValues *prometheus.CounterVec
+}
+
+// NewRecorder creates all metrics and registers them with reg. A nil reg
+// uses the Prometheus default registerer.
+func NewRecorder(reg prometheus.Registerer) *Recorder {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	factory := With(reg)
+
+	r := &Recorder{
+		ChatWindow: NewWindowStore(time.Minute, 24*time.Hour, DefaultWindowBuckets),
+	}
+
+	r.RequestCounter = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "genai_app_http_requests_total",
 			Help: "Total number of HTTP requests",
@@ -19,8 +94,7 @@ var (
 		[]string{"method", "endpoint", "status"},
 	)
 
-	// RequestDuration measures HTTP request durations
-	RequestDuration = promauto.NewHistogramVec(
+	r.RequestDuration = factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "genai_app_http_request_duration_seconds",
 			Help:    "HTTP request duration in seconds",
@@ -29,8 +103,7 @@ var (
 		[]string{"method", "endpoint"},
 	)
 
-	// ChatTokensCounter counts tokens in chat requests and responses
-	ChatTokensCounter = promauto.NewCounterVec(
+	r.ChatTokensCounter = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "genai_app_chat_tokens_total",
 			Help: "Total number of tokens processed in chat",
@@ -38,8 +111,7 @@ var (
 		[]string{"direction", "model"},
 	)
 
-	// ModelLatency measures model response time
-	ModelLatency = promauto.NewHistogramVec(
+	r.ModelLatency = factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "genai_app_model_latency_seconds",
 			Help:    "Model response time in seconds",
@@ -48,44 +120,144 @@ var (
 		[]string{"model", "operation"},
 	)
 
-	// FirstTokenLatency measures time to first token
-	FirstTokenLatency = promauto.NewHistogramVec(
+	r.ActiveRequests = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "genai_app_active_requests",
+			Help: "Number of currently active requests",
+		},
+	)
+
+	// Server-side errors by type (see errors.go) and endpoint
+	r.ErrorCounter = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_errors_total",
+			Help: "Total number of errors",
+		},
+		[]string{"type", "endpoint"},
+	)
+
+	r.FrontendErrorCounter = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_frontend_errors_total",
+			Help: "Total number of errors reported by the frontend",
+		},
+		[]string{"type"},
+	)
+
+	r.InjectedFaults = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_injected_faults_total",
+			Help: "Total number of faults applied by fault injection",
+		},
+		[]string{"type"},
+	)
+
+	r.DroppedLabelValues = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_dropped_label_values_total",
+			Help: "Total number of observations recorded as other because their metric reached its series limit",
+		},
+		[]string{"metric"},
+	)
+	r.Labels = NewLabelGuard(DefaultSeriesLimit, r.DroppedLabelValues)
+
+	r.TelemetryReports = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_telemetry_reports_total",
+			Help: "Total number of frontend telemetry reports by outcome",
+		},
+		[]string{"endpoint", "result"},
+	)
+
+	// Latencies measured by the browser, kept apart from the server-side histograms
+	r.ClientLatency = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_client_latency_seconds",
+			Help:    "Latency measured by the frontend in seconds",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"measurement"},
+	)
+
+	// Client minus server time for reports correlated with a chat request
+	r.ClientOverhead = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_client_overhead_seconds",
+			Help:    "Time the frontend measured on top of the server for the same request in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"measurement"},
+	)
+
+	// Time to first token
+	r.FirstTokenLatency = factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "genai_app_first_token_latency_seconds",
 			Help:    "Time to first token in seconds",
-			Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 5},
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5},
 		},
 		[]string{"model"},
 	)
 
-	// ErrorCounter counts errors by type
-	ErrorCounter = promauto.NewCounterVec(
+	// GenAI semantic convention metrics, named and bucketed as the OpenTelemetry
+	// gen_ai.client.token.usage and gen_ai.client.operation.duration histograms
+	// appear once translated to Prometheus
+	r.GenAITokenUsage = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gen_ai_client_token_usage",
+			Help:    "Measures number of input and output tokens used",
+			Buckets: []float64{1, 4, 16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864},
+		},
+		[]string{"gen_ai_operation_name", "gen_ai_system", "gen_ai_request_model", "gen_ai_response_model", "gen_ai_token_type"},
+	)
+
+	r.GenAIUsageEstimated = factory.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "genai_app_errors_total",
-			Help: "Total number of errors",
+			Name: "genai_app_token_usage_estimated_total",
+			Help: "GenAI operations whose gen_ai_client_token_usage is estimated because the backend did not report it",
 		},
-		[]string{"type", "operation"},
+		[]string{"gen_ai_operation_name"},
 	)
 
-	// ActiveRequests tracks currently active requests
-	ActiveRequests = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "genai_app_active_requests",
-			Help: "Number of currently active requests",
+	r.GenAIOperationDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gen_ai_client_operation_duration_seconds",
+			Help:    "GenAI operation duration",
+			Buckets: []float64{0.01, 0.02, 0.04, 0.08, 0.16, 0.32, 0.64, 1.28, 2.56, 5.12, 10.24, 20.48, 40.96, 81.92},
 		},
+		[]string{"gen_ai_operation_name", "gen_ai_system", "gen_ai_request_model", "gen_ai_response_model", "error_type"},
 	)
 
-	// ModelMemoryUsage tracks model memory usage
-	ModelMemoryUsage = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "genai_app_model_memory_bytes",
-			Help: "Model memory usage in bytes",
+	// Time between consecutive tokens of a stream
+	r.InterTokenLatency = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_inter_token_latency_seconds",
+			Help:    "Time between consecutive streamed tokens in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		},
+		[]string{"model"},
+	)
+
+	// Per-request inter-token statistics (mean, p95 and max gap)
+	r.StreamJitter = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_stream_jitter_seconds",
+			Help:    "Per-request inter-token latency statistics in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10},
+		},
+		[]string{"model", "statistic"},
+	)
+
+	r.TokenStalls = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_token_stalls_total",
+			Help: "Total number of inter-token gaps above the stall threshold",
 		},
 		[]string{"model"},
 	)
 
-	// LlamaCppContextSize measures the context window size
-	LlamaCppContextSize = promauto.NewGaugeVec(
+	// LlamaCpp metrics
+	r.LlamaCppContextSize = factory.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "genai_app_llamacpp_context_size",
 			Help: "Context window size in tokens for llama.cpp models",
@@ -93,8 +265,7 @@ var (
 		[]string{"model"},
 	)
 
-	// LlamaCppPromptEvalTime measures the time spent evaluating the prompt
-	LlamaCppPromptEvalTime = promauto.NewHistogramVec(
+	r.LlamaCppPromptEvalTime = factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "genai_app_llamacpp_prompt_eval_seconds",
 			Help:    "Time spent evaluating the prompt in seconds",
@@ -103,8 +274,7 @@ var (
 		[]string{"model"},
 	)
 
-	// LlamaCppTokensPerSecond measures generation speed
-	LlamaCppTokensPerSecond = promauto.NewGaugeVec(
+	r.LlamaCppTokensPerSecond = factory.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "genai_app_llamacpp_tokens_per_second",
 			Help: "Tokens generated per second",
@@ -112,8 +282,7 @@ var (
 		[]string{"model"},
 	)
 
-	// LlamaCppMemoryPerToken tracks memory usage per token
-	LlamaCppMemoryPerToken = promauto.NewGaugeVec(
+	r.LlamaCppMemoryPerToken = factory.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "genai_app_llamacpp_memory_per_token_bytes",
 			Help: "Memory usage per token in bytes",
@@ -121,8 +290,7 @@ var (
 		[]string{"model"},
 	)
 
-	// LlamaCppThreadsUsed tracks the number of threads used for inference
-	LlamaCppThreadsUsed = promauto.NewGaugeVec(
+	r.LlamaCppThreadsUsed = factory.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "genai_app_llamacpp_threads_used",
 			Help: "Number of threads used for inference",
@@ -130,20 +298,106 @@ var (
 		[]string{"model"},
 	)
 
-	// LlamaCppBatchSize tracks the batch size used for inference
-	LlamaCppBatchSize = promauto.NewGaugeVec(
+	r.LlamaCppBatchSize = factory.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "genai_app_llamacpp_batch_size",
 			Help: "Batch size used for inference",
 		},
 		[]string{"model"},
 	)
-)
 
-// SetupMetricsServer initializes and returns an HTTP server for metrics
-func SetupMetricsServer(addr string) *http.Server {
+	// Embedding metrics
+	r.EmbeddingLatency = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_embedding_latency_seconds",
+			Help:    "Embedding request latency in seconds",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		},
+		[]string{"model"},
+	)
+
+	r.EmbeddingBatchSize = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_embedding_batch_size",
+			Help:    "Number of inputs per embedding request",
+			Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128, 256},
+		},
+		[]string{"model"},
+	)
+
+	r.EmbeddingDimensions = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "genai_app_embedding_dimensions",
+			Help: "Dimension of the vectors returned by the embedding model",
+		},
+		[]string{"model"},
+	)
+
+	// Upstream (model backend) client metrics
+	r.UpstreamPhaseDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_upstream_phase_duration_seconds",
+			Help:    "Duration of upstream connection phases (dns, connect, tls, ttfb) in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10},
+		},
+		[]string{"operation", "phase"},
+	)
+
+	r.UpstreamRequestDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_upstream_request_duration_seconds",
+			Help:    "Upstream request duration until the response body is closed in seconds",
+			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 20, 30, 60},
+		},
+		[]string{"operation"},
+	)
+
+	r.UpstreamRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_upstream_requests_total",
+			Help: "Total number of upstream requests by status code",
+		},
+		[]string{"operation", "status"},
+	)
+
+	r.UpstreamRetries = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_upstream_retries_total",
+			Help: "Total number of retried upstream requests",
+		},
+		[]string{"operation"},
+	)
+
+	// Cost and energy estimates from the pricing table
+	r.CostCounter = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_cost_total",
+			Help: "Estimated cost of chat requests in the pricing table currency",
+		},
+		[]string{"model"},
+	)
+
+	r.EnergyCounter = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_energy_joules_total",
+			Help: "Estimated energy used by chat requests in joules",
+		},
+		[]string{"model"},
+	)
+
+	return r
+}
+
+// Handler exposes the metrics of gatherer. OpenMetrics is negotiated with scrapers
+// that ask for it, which is required for exemplars to be exposed.
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// SetupMetricsServer initializes and returns an HTTP server exposing the metrics of gatherer
+func SetupMetricsServer(addr string, gatherer prometheus.Gatherer) *http.Server {
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", Handler(gatherer))
 
 	return &http.Server{
 		Addr:         addr,
@@ -154,39 +408,35 @@ func SetupMetricsServer(addr string) *http.Server {
 }
 
 // RecordModelInference records metrics for a model inference
-func RecordModelInference(model string, startTime time.Time, tokensIn, tokensOut int, firstTokenTime time.Time) {
+func (r *Recorder) RecordModelInference(model string, startTime time.Time, tokensIn, tokensOut int, firstTokenTime time.Time) {
 	// Record total tokens
-	ChatTokensCounter.WithLabelValues("input", model).Add(float64(tokensIn))
-	ChatTokensCounter.WithLabelValues("output", model).Add(float64(tokensOut))
+	r.ChatTokensCounter.WithLabelValues("input", model).Add(float64(tokensIn))
+	r.ChatTokensCounter.WithLabelValues("output", model).Add(float64(tokensOut))
 
 	// Record model latency
-	ModelLatency.WithLabelValues(model, "inference").Observe(time.Since(startTime).Seconds())
+	r.ModelLatency.WithLabelValues(model, "inference").Observe(time.Since(startTime).Seconds())
 
 	// Record time to first token
 	if !firstTokenTime.IsZero() {
-		FirstTokenLatency.WithLabelValues(model).Observe(firstTokenTime.Sub(startTime).Seconds())
+		r.FirstTokenLatency.WithLabelValues(model).Observe(firstTokenTime.Sub(startTime).Seconds())
 	}
 }
 
 // RecordLlamaCppMetrics records metrics specific to llama.cpp
-func RecordLlamaCppMetrics(model string, contextSize int, promptEvalTime time.Duration, 
-	tokensPerSecond float64, memoryPerToken float64, threadsUsed int, batchSize int) {
-	
-	// Record context size
-	LlamaCppContextSize.WithLabelValues(model).Set(float64(contextSize))
-	
-	// Record prompt evaluation time
-	LlamaCppPromptEvalTime.WithLabelValues(model).Observe(promptEvalTime.Seconds())
-	
-	// Record tokens per second
-	LlamaCppTokensPerSecond.WithLabelValues(model).Set(tokensPerSecond)
-	
-	// Record memory per token
-	LlamaCppMemoryPerToken.WithLabelValues(model).Set(memoryPerToken)
-	
-	// Record threads used
-	LlamaCppThreadsUsed.WithLabelValues(model).Set(float64(threadsUsed))
-	
-	// Record batch size
-	LlamaCppBatchSize.WithLabelValues(model).Set(float64(batchSize))
+func (r *Recorder) RecordLlamaCppMetrics(model string, metrics LlamaCppMetrics) {
+	r.LlamaCppContextSize.WithLabelValues(model).Set(float64(metrics.ContextSize))
+	r.LlamaCppPromptEvalTime.WithLabelValues(model).Observe(metrics.PromptEvalTime / 1000.0) // Convert ms to seconds
+	r.LlamaCppTokensPerSecond.WithLabelValues(model).Set(metrics.TokensPerSecond)
+	r.LlamaCppMemoryPerToken.WithLabelValues(model).Set(metrics.MemoryPerToken)
+	r.LlamaCppThreadsUsed.WithLabelValues(model).Set(float64(metrics.ThreadsUsed))
+	r.LlamaCppBatchSize.WithLabelValues(model).Set(float64(metrics.BatchSize))
+}
+
+// RecordEmbedding records latency, batch size and vector dimensions for an embedding call
+func (r *Recorder) RecordEmbedding(model string, batchSize, dimensions int, duration time.Duration) {
+	r.EmbeddingLatency.WithLabelValues(r.Labels.Values("genai_app_embedding_latency_seconds", model)...).Observe(duration.Seconds())
+	r.EmbeddingBatchSize.WithLabelValues(r.Labels.Values("genai_app_embedding_batch_size", model)...).Observe(float64(batchSize))
+	if dimensions > 0 {
+		r.EmbeddingDimensions.WithLabelValues(r.Labels.Values("genai_app_embedding_dimensions", model)...).Set(float64(dimensions))
+	}
 }
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// Exporter modes selecting where metrics are sent
+const (
+	ExporterPrometheus = "prometheus"
+	ExporterOTLP       = "otlp"
+	ExporterBoth       = "both"
+)
+
+// ParseExporter validates an exporter mode, an empty mode means prometheus
+func ParseExporter(mode string) (string, error) {
+	switch mode {
+	case "":
+		return ExporterPrometheus, nil
+	case ExporterPrometheus, ExporterOTLP, ExporterBoth:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown metrics exporter %q, use prometheus, otlp or both", mode)
+	}
+}
+
+// ExportsPrometheus reports whether mode serves metrics for Prometheus to scrape
+func ExportsPrometheus(mode string) bool {
+	return mode == ExporterPrometheus || mode == ExporterBoth
+}
+
+// ExportsOTLP reports whether mode pushes metrics over OTLP
+func ExportsOTLP(mode string) bool {
+	return mode == ExporterOTLP || mode == ExporterBoth
+}
+
+// SetupOTLPExport periodically pushes every metric of gatherer to the OTLP
+// receiver of cfg, over the same protocol, TLS settings and headers as the
+// traces. The metrics are read through the Prometheus bridge, so the
+// instruments are defined once in the Recorder and mirrored as they are.
+// It returns a cleanup function that flushes the last collection.
+func SetupOTLPExport(gatherer prometheus.Gatherer, cfg tracing.Config, res *resource.Resource, interval time.Duration) (func(), error) {
+	exporter, err := newOTLPExporter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metrics exporter: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(otelprometheus.NewMetricProducer(otelprometheus.WithGatherer(gatherer))),
+	)
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(reader),
+	)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Error shutting down meter provider")
+		}
+	}, nil
+}
+
+// newOTLPExporter creates the metric exporter for the OTLP connection of cfg
+func newOTLPExporter(cfg tracing.Config) (sdkmetric.Exporter, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Protocol == tracing.ProtocolGRPC {
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(cfg.Endpoint)}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(cfg.Headers))
+		}
+		switch {
+		case cfg.Insecure:
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		case tlsConfig != nil:
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		return otlpmetricgrpc.New(context.Background(), opts...)
+	}
+
+	opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+	}
+	switch {
+	case cfg.Insecure:
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	case tlsConfig != nil:
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+	}
+	return otlpmetrichttp.New(context.Background(), opts...)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LatencyStats summarizes a latency histogram in seconds
+type LatencyStats struct {
+	Count   uint64  `json:"count"`
+	Average float64 `json:"average"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+}
+
+// cumulativeHistogram is a histogram merged from one or more series with the same buckets
+type cumulativeHistogram struct {
+	count  uint64
+	sum    float64
+	bounds []float64
+	counts []uint64
+}
+
+// add merges a histogram series into h
+func (h *cumulativeHistogram) add(hist *dto.Histogram) {
+	h.count += hist.GetSampleCount()
+	h.sum += hist.GetSampleSum()
+
+	buckets := hist.GetBucket()
+	if h.bounds == nil {
+		h.bounds = make([]float64, len(buckets))
+		h.counts = make([]uint64, len(buckets))
+		for i, b := range buckets {
+			h.bounds[i] = b.GetUpperBound()
+		}
+	}
+	for i, b := range buckets {
+		if i < len(h.counts) {
+			h.counts[i] += b.GetCumulativeCount()
+		}
+	}
+}
+
+// quantile estimates the q-quantile with linear interpolation inside the bucket,
+// the same way PromQL's histogram_quantile does
+func (h *cumulativeHistogram) quantile(q float64) float64 {
+	if h.count == 0 || len(h.bounds) == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+	lowerBound, lowerCount := 0.0, uint64(0)
+	for i, upperBound := range h.bounds {
+		if math.IsInf(upperBound, 1) {
+			break
+		}
+		if float64(h.counts[i]) >= rank {
+			inBucket := h.counts[i] - lowerCount
+			if inBucket == 0 {
+				return upperBound
+			}
+			return lowerBound + (upperBound-lowerBound)*(rank-float64(lowerCount))/float64(inBucket)
+		}
+		lowerBound, lowerCount = upperBound, h.counts[i]
+	}
+
+	// The quantile falls into the +Inf bucket, report the highest finite bound
+	return lowerBound
+}
+
+// stats returns the summary of the merged histogram
+func (h *cumulativeHistogram) stats() LatencyStats {
+	stats := LatencyStats{Count: h.count}
+	if h.count == 0 {
+		return stats
+	}
+	stats.Average = h.sum / float64(h.count)
+	stats.P50 = h.quantile(0.5)
+	stats.P90 = h.quantile(0.9)
+	stats.P99 = h.quantile(0.99)
+	return stats
+}
+
+// HistogramStats summarizes the series of a histogram collector grouped by the value
+// of groupBy. Series whose labels do not match every entry of filter are skipped.
+// An empty groupBy merges all matching series under the "" key.
+func HistogramStats(collector prometheus.Collector, groupBy string, filter map[string]string) map[string]LatencyStats {
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+
+	groups := make(map[string]*cumulativeHistogram)
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil || m.Histogram == nil {
+			continue
+		}
+
+		if !matchLabels(m, filter) {
+			continue
+		}
+
+		key := ""
+		for _, pair := range m.GetLabel() {
+			if groupBy != "" && pair.GetName() == groupBy {
+				key = pair.GetValue()
+			}
+		}
+		if groups[key] == nil {
+			groups[key] = &cumulativeHistogram{}
+		}
+		groups[key].add(m.Histogram)
+	}
+
+	result := make(map[string]LatencyStats, len(groups))
+	for key, hist := range groups {
+		result[key] = hist.stats()
+	}
+	return result
+}
+
+// MergedHistogramStats summarizes all series of a histogram collector matching filter
+func MergedHistogramStats(collector prometheus.Collector, filter map[string]string) LatencyStats {
+	return HistogramStats(collector, "", filter)[""]
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestQuantileInterpolation(t *testing.T) {
+	// 10 samples up to 1s, 10 more up to 2s, 20 more up to 4s and 10 over 4s
+	h := &cumulativeHistogram{
+		count:  50,
+		bounds: []float64{1, 2, 4, math.Inf(1)},
+		counts: []uint64{10, 20, 40, 50},
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 0},
+		{0.1, 0.5},  // rank 5 is halfway through the first bucket, which starts at 0
+		{0.2, 1},    // rank 10 is the top of the first bucket
+		{0.3, 1.5},  // rank 15 is halfway through the second bucket
+		{0.5, 2.5},  // rank 25 is a quarter through the third bucket
+		{0.8, 4},    // rank 40 is the top of the last finite bucket
+		{0.9, 4},    // rank 45 falls into +Inf, the highest finite bound is reported
+		{0.99, 4},   // same
+		{1, 4},      // same
+		{0.44, 2.2}, // rank 22 is a tenth through the third bucket
+	}
+	for _, tt := range tests {
+		if got := h.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestQuantileEdgeCases(t *testing.T) {
+	tests := []struct {
+		name string
+		h    *cumulativeHistogram
+		q    float64
+		want float64
+	}{
+		{"empty", &cumulativeHistogram{bounds: []float64{1, 2}, counts: []uint64{0, 0}}, 0.5, 0},
+		{"no buckets", &cumulativeHistogram{count: 3}, 0.5, 0},
+		// An empty bucket reached by rank 0 reports its upper bound
+		{"empty first bucket", &cumulativeHistogram{count: 4, bounds: []float64{1, 2}, counts: []uint64{0, 4}}, 0, 1},
+		{"single bucket", &cumulativeHistogram{count: 4, bounds: []float64{2}, counts: []uint64{4}}, 0.5, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.h.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: quantile(%v) = %v, want %v", tt.name, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramStatsMergesAndGroups(t *testing.T) {
+	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "test_seconds",
+		Buckets: []float64{1, 2, 4},
+	}, []string{"model", "operation"})
+	for _, v := range []float64{0.5, 1.5} {
+		hist.WithLabelValues("a", "inference").Observe(v)
+	}
+	for _, v := range []float64{3, 3} {
+		hist.WithLabelValues("b", "inference").Observe(v)
+	}
+	hist.WithLabelValues("b", "embedding").Observe(10)
+
+	byModel := HistogramStats(hist, "model", map[string]string{"operation": "inference"})
+	if len(byModel) != 2 {
+		t.Fatalf("got %d groups, want 2", len(byModel))
+	}
+	if got := byModel["a"]; got.Count != 2 || got.Average != 1 || got.P50 != 1 {
+		t.Errorf("model a = %+v, want 2 samples averaging 1 with a p50 of 1", got)
+	}
+	if got := byModel["b"]; got.Count != 2 || got.Average != 3 || got.P50 != 3 {
+		t.Errorf("model b = %+v, want 2 samples averaging 3 with a p50 of 3", got)
+	}
+
+	merged := MergedHistogramStats(hist, nil)
+	if merged.Count != 5 || merged.P99 != 4 {
+		t.Errorf("merged = %+v, want 5 samples with a p99 capped at the highest bound 4", merged)
+	}
+}
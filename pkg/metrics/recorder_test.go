@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Recorders on their own registries do not collide or share series
+func TestRecorderIsolatedRegistries(t *testing.T) {
+	regA, regB := prometheus.NewRegistry(), prometheus.NewRegistry()
+	a, b := NewRecorder(regA), NewRecorder(regB)
+
+	a.RequestCounter.WithLabelValues("POST", ChatEndpoint, "200").Add(3)
+	a.RecordError(ChatEndpoint, ErrorUpstream5xx)
+
+	if got := testutil.ToFloat64(a.ErrorCounter.WithLabelValues(ErrorUpstream5xx, ChatEndpoint)); got != 1 {
+		t.Errorf("errors recorded on a = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(b.ErrorCounter); got != 0 {
+		t.Errorf("error series on b = %d, want 0", got)
+	}
+	if got, want := a.ChatErrorRate(), 1.0/3; got != want {
+		t.Errorf("a.ChatErrorRate() = %v, want %v", got, want)
+	}
+	if got := b.ChatErrorRate(); got != 0 {
+		t.Errorf("b.ChatErrorRate() = %v, want 0", got)
+	}
+
+	count, err := testutil.GatherAndCount(regB, "genai_app_errors_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("genai_app_errors_total series gathered from regB = %d, want 0", count)
+	}
+}
+
+func TestRecordModelInference(t *testing.T) {
+	rec := NewRecorder(prometheus.NewRegistry())
+	start := time.Now().Add(-2 * time.Second)
+	rec.RecordModelInference("m", start, 12, 34, start.Add(500*time.Millisecond))
+
+	if got := testutil.ToFloat64(rec.ChatTokensCounter.WithLabelValues("input", "m")); got != 12 {
+		t.Errorf("input tokens = %v, want 12", got)
+	}
+	if got := testutil.ToFloat64(rec.ChatTokensCounter.WithLabelValues("output", "m")); got != 34 {
+		t.Errorf("output tokens = %v, want 34", got)
+	}
+	if got := testutil.CollectAndCount(rec.ModelLatency); got != 1 {
+		t.Errorf("model latency series = %d, want 1", got)
+	}
+	if got := testutil.CollectAndCount(rec.FirstTokenLatency); got != 1 {
+		t.Errorf("first token latency series = %d, want 1", got)
+	}
+}
+
+// The summary counts chats only, like the error rate
+func TestSummaryTotalRequests(t *testing.T) {
+	rec := NewRecorder(prometheus.NewRegistry())
+	rec.RequestCounter.WithLabelValues("POST", ChatEndpoint, "200").Add(4)
+	rec.RequestCounter.WithLabelValues("OPTIONS", ChatEndpoint, "200").Add(4)
+	rec.RequestCounter.WithLabelValues("GET", "/metrics/summary", "200").Add(10)
+
+	if got := rec.Summary("m", false).TotalRequests; got != 4 {
+		t.Errorf("total requests = %v, want 4", got)
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// GapStats summarizes the gaps between tokens of one streamed response
+type GapStats struct {
+	Count int
+	Mean  time.Duration
+	P95   time.Duration
+	Max   time.Duration
+}
+
+// TokenGaps tracks the time between consecutive tokens of a streamed response
+type TokenGaps struct {
+	last time.Time
+	gaps []time.Duration
+}
+
+// Observe records a token received at t and returns the gap since the previous
+// token. ok is false for the first token, which has no gap.
+func (g *TokenGaps) Observe(t time.Time) (gap time.Duration, ok bool) {
+	if g.last.IsZero() {
+		g.last = t
+		return 0, false
+	}
+	gap = t.Sub(g.last)
+	g.last = t
+	g.gaps = append(g.gaps, gap)
+	return gap, true
+}
+
+// Stats returns the mean, 95th percentile and largest gap seen so far
+func (g *TokenGaps) Stats() GapStats {
+	stats := GapStats{Count: len(g.gaps)}
+	if stats.Count == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), g.gaps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, gap := range sorted {
+		total += gap
+	}
+	stats.Mean = total / time.Duration(stats.Count)
+	stats.P95 = sorted[(stats.Count*95+99)/100-1]
+	stats.Max = sorted[stats.Count-1]
+	return stats
+}
+
+// RecordTokenGap records the time between two tokens and counts it as a stall
+// when it exceeds threshold. It reports whether the gap was a stall.
+func (r *Recorder) RecordTokenGap(model string, gap, threshold time.Duration) bool {
+	r.InterTokenLatency.WithLabelValues(model).Observe(gap.Seconds())
+	if threshold > 0 && gap > threshold {
+		r.TokenStalls.WithLabelValues(model).Inc()
+		return true
+	}
+	return false
+}
+
+// RecordStreamJitter records the per-request inter-token statistics of a stream
+func (r *Recorder) RecordStreamJitter(model string, stats GapStats) {
+	if stats.Count == 0 {
+		return
+	}
+	r.StreamJitter.WithLabelValues(model, "mean").Observe(stats.Mean.Seconds())
+	r.StreamJitter.WithLabelValues(model, "p95").Observe(stats.P95.Seconds())
+	r.StreamJitter.WithLabelValues(model, "max").Observe(stats.Max.Seconds())
+}
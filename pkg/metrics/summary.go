@@ -4,221 +4,241 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
-	// Import only what's needed for this file
-	_ "github.com/prometheus/client_golang/prometheus" // blank import for side effects
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/rs/zerolog/log"
 )
 
-// MetricsSummary holds summarized metrics for frontend display
-type MetricsSummary struct {
-	TotalRequests      int     `json:"totalRequests"`
-	AverageResponseTime float64 `json:"averageResponseTime"`
-	TokensGenerated    int     `json:"tokensGenerated"`
-	TokensProcessed    int     `json:"tokensProcessed"`
-	ActiveUsers        int     `json:"activeUsers"`
-	ErrorRate          float64 `json:"errorRate"`
-}
-
-// MessageMetrics contains metrics for a single message
-type MessageMetrics struct {
-	MessageID        string  `json:"message_id"`
-	TokensIn         int     `json:"tokens_in"`
-	TokensOut        int     `json:"tokens_out"`
-	ResponseTimeMs   float64 `json:"response_time_ms"`
-	FirstTokenTimeMs float64 `json:"time_to_first_token_ms"`
-	Timestamp        time.Time
+// LlamaCppMetrics represents metrics reported for llama.cpp models
+type LlamaCppMetrics struct {
+	ContextSize     int     `json:"context_size"`
+	PromptEvalTime  float64 `json:"prompt_eval_time_ms"`
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	MemoryPerToken  float64 `json:"memory_per_token_bytes"`
+	ThreadsUsed     int     `json:"threads_used"`
+	BatchSize       int     `json:"batch_size"`
+	ModelType       string  `json:"model_type"`
 }
 
-// ErrorLogEntry contains data about an error
-type ErrorLogEntry struct {
-	ErrorType   string `json:"error_type"`
-	StatusCode  int    `json:"status_code"`
-	InputLength int    `json:"input_length"`
-	Timestamp   string `json:"timestamp"`
-}
-
-// Storage for metrics and active users
-var (
-	messageMetrics     []MessageMetrics
-	errorLogs          []ErrorLogEntry
-	activeUserSessions map[string]time.Time
-	lastCleanup        time.Time
-	metricsMutex       sync.RWMutex
-)
-
-func init() {
-	messageMetrics = make([]MessageMetrics, 0)
-	errorLogs = make([]ErrorLogEntry, 0)
-	activeUserSessions = make(map[string]time.Time)
-	lastCleanup = time.Now()
+// MetricsSummary holds summarized metrics for frontend display. With a window,
+// the chat totals, error rate, response time and time to first token cover the
+// window; cost, energy, inter-token latency and the breakdowns by model and
+// endpoint always cover the process lifetime.
+type MetricsSummary struct {
+	TotalRequests       float64          `json:"totalRequests"`
+	AverageResponseTime float64          `json:"averageResponseTime"`
+	TokensGenerated     float64          `json:"tokensGenerated"`
+	TokensProcessed     float64          `json:"tokensProcessed"`
+	ActiveUsers         float64          `json:"activeUsers"`
+	ErrorRate           float64          `json:"errorRate"`
+	TotalCost           float64          `json:"totalCost"`
+	TotalEnergyJoules   float64          `json:"totalEnergyJoules"`
+	LlamaCppMetrics     *LlamaCppMetrics `json:"llamaCppMetrics,omitempty"`
+	Window              *WindowSummary   `json:"window,omitempty"`
+
+	// Latency percentiles estimated from the histogram buckets, in seconds
+	ResponseTime            LatencyStats            `json:"responseTime"`
+	TimeToFirstToken        LatencyStats            `json:"timeToFirstToken"`
+	InterTokenLatency       LatencyStats            `json:"interTokenLatency"`
+	ResponseTimeByModel     map[string]LatencyStats `json:"responseTimeByModel"`
+	TimeToFirstTokenByModel map[string]LatencyStats `json:"timeToFirstTokenByModel"`
+	ResponseTimeByEndpoint  map[string]LatencyStats `json:"responseTimeByEndpoint"`
 }
 
-// CleanupOldMetrics removes metrics older than the retention period
-func CleanupOldMetrics() {
-	metricsMutex.Lock()
-	defer metricsMutex.Unlock()
+// Summary builds a summary of the lifetime metrics for model. llama.cpp metrics
+// are included when llamaCpp is set and the frontend has reported them.
+func (r *Recorder) Summary(model string, llamaCpp bool) MetricsSummary {
+	var llamaCppMetrics *LlamaCppMetrics
+	if llamaCpp {
+		llamaCppMetrics = r.LlamaCppMetrics(model)
+	}
 
-	// Only clean up every hour
-	if time.Since(lastCleanup) < time.Hour {
-		return
+	chatResponseTime := MergedHistogramStats(r.RequestDuration, map[string]string{"endpoint": ChatEndpoint})
+	return MetricsSummary{
+		// Like the error rate, only chats count, not scrapes or preflights
+		TotalRequests:       counterSum(r.RequestCounter, map[string]string{"method": "POST", "endpoint": ChatEndpoint}),
+		AverageResponseTime: chatResponseTime.Average,
+		TokensGenerated:     counterValue(r.ChatTokensCounter, "output", model),
+		TokensProcessed:     counterValue(r.ChatTokensCounter, "input", model),
+		ActiveUsers:         gaugeValue(r.ActiveRequests),
+		ErrorRate:           r.ChatErrorRate(),
+		TotalCost:           counterValue(r.CostCounter),
+		TotalEnergyJoules:   counterValue(r.EnergyCounter),
+		LlamaCppMetrics:     llamaCppMetrics,
+
+		ResponseTime:            chatResponseTime,
+		TimeToFirstToken:        MergedHistogramStats(r.FirstTokenLatency, nil),
+		InterTokenLatency:       MergedHistogramStats(r.InterTokenLatency, nil),
+		ResponseTimeByModel:     HistogramStats(r.ModelLatency, "model", map[string]string{"operation": "inference"}),
+		TimeToFirstTokenByModel: HistogramStats(r.FirstTokenLatency, "model", nil),
+		ResponseTimeByEndpoint:  HistogramStats(r.RequestDuration, "endpoint", nil),
 	}
+}
 
-	retentionCutoff := time.Now().Add(-24 * time.Hour)
-	newMetrics := make([]MessageMetrics, 0)
+// ActiveRequestCount returns the number of requests currently being served
+func (r *Recorder) ActiveRequestCount() float64 {
+	return gaugeValue(r.ActiveRequests)
+}
 
-	// Keep only recent metrics
-	for _, metric := range messageMetrics {
-		if metric.Timestamp.After(retentionCutoff) {
-			newMetrics = append(newMetrics, metric)
-		}
+// LlamaCppMetrics returns the reported llama.cpp metrics for model, or nil if none were reported
+func (r *Recorder) LlamaCppMetrics(model string) *LlamaCppMetrics {
+	contextSize := int(gaugeVecValue(r.LlamaCppContextSize, model))
+	if contextSize == 0 {
+		return nil
 	}
 
-	// Clean up old user sessions (inactive for more than 30 minutes)
-	sessionTimeout := time.Now().Add(-30 * time.Minute)
-	for ip, lastSeen := range activeUserSessions {
-		if lastSeen.Before(sessionTimeout) {
-			delete(activeUserSessions, ip)
-		}
+	return &LlamaCppMetrics{
+		ContextSize:     contextSize,
+		PromptEvalTime:  histogramAverage(r.LlamaCppPromptEvalTime, model) * 1000, // Convert to ms
+		TokensPerSecond: gaugeVecValue(r.LlamaCppTokensPerSecond, model),
+		MemoryPerToken:  gaugeVecValue(r.LlamaCppMemoryPerToken, model),
+		ThreadsUsed:     int(gaugeVecValue(r.LlamaCppThreadsUsed, model)),
+		BatchSize:       int(gaugeVecValue(r.LlamaCppBatchSize, model)),
+		ModelType:       "llama.cpp",
 	}
+}
 
-	messageMetrics = newMetrics
-	lastCleanup = time.Now()
-	log.Info().Int("metrics_count", len(newMetrics)).Int("active_users", len(activeUserSessions)).Msg("Cleaned up old metrics")
+// setCORSHeaders sets the headers the frontend needs to call the metrics endpoints
+func setCORSHeaders(w http.ResponseWriter, methods string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 }
 
-// HandleMetricsSummary returns a summary of metrics for the frontend
-func HandleMetricsSummary() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// HandleSummary returns a summary of metrics for the frontend. An optional window
+// query parameter restricts the chat totals, error rate and chat latencies to
+// recent requests, see MetricsSummary for the fields it leaves as they are.
+func (r *Recorder) HandleSummary(model string, llamaCpp bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		setCORSHeaders(w, "GET, OPTIONS")
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		CleanupOldMetrics()
-
-		metricsMutex.RLock()
-		defer metricsMutex.RUnlock()
-
-		// Calculate summary metrics
-		totalRequests := len(messageMetrics)
-		var totalResponseTime float64
-		var totalOutputTokens int
-		var totalInputTokens int
-		var totalErrors int
-
-		for _, metric := range messageMetrics {
-			totalResponseTime += metric.ResponseTimeMs / 1000 // Convert to seconds
-			totalOutputTokens += metric.TokensOut
-			totalInputTokens += metric.TokensIn
-		}
 
-		totalErrors = len(errorLogs)
-
-		avgResponseTime := 0.0
-		if totalRequests > 0 {
-			avgResponseTime = totalResponseTime / float64(totalRequests)
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
 		}
 
-		errorRate := 0.0
-		if totalRequests+totalErrors > 0 {
-			errorRate = float64(totalErrors) / float64(totalRequests+totalErrors)
+		var window time.Duration
+		if value := req.URL.Query().Get("window"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 || parsed > r.ChatWindow.Retention() {
+				http.Error(w, fmt.Sprintf("Invalid window, use a duration up to %s such as 5m, 1h or 24h", r.ChatWindow.Retention()), http.StatusBadRequest)
+				return
+			}
+			window = parsed
 		}
 
-		summary := MetricsSummary{
-			TotalRequests:      totalRequests,
-			AverageResponseTime: avgResponseTime,
-			TokensGenerated:    totalOutputTokens,
-			TokensProcessed:    totalInputTokens,
-			ActiveUsers:        len(activeUserSessions),
-			ErrorRate:          errorRate,
+		summary := r.Summary(model, llamaCpp)
+
+		// Windowed summaries replace the lifetime chat totals
+		if window > 0 {
+			windowSummary := r.ChatWindow.Summary(window)
+			windowSummary.Window = req.URL.Query().Get("window")
+			summary.Window = &windowSummary
+			summary.TotalRequests = float64(windowSummary.Requests)
+			summary.AverageResponseTime = windowSummary.ResponseTime.Average
+			summary.TokensGenerated = float64(windowSummary.TokensOut)
+			summary.TokensProcessed = float64(windowSummary.TokensIn)
+			summary.ErrorRate = windowSummary.ErrorRate
+			summary.ResponseTime = windowSummary.ResponseTime
+			summary.TimeToFirstToken = windowSummary.FirstToken
 		}
 
 		if err := json.NewEncoder(w).Encode(summary); err != nil {
 			log.Error().Err(err).Msg("Failed to encode metrics summary")
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 	}
 }
 
-// HandleLogMetrics handles metric logging from the frontend
-func HandleLogMetrics() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.WriteHeader(http.StatusOK)
-			return
+// counterValue returns the value of the counter with labelValues, or the sum of
+// all its series when no labels are given
+func counterValue(counter *prometheus.CounterVec, labelValues ...string) float64 {
+	if len(labelValues) > 0 {
+		c, err := counter.GetMetricWithLabelValues(labelValues...)
+		if err != nil {
+			return 0.0
 		}
-
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+		metric := &dto.Metric{}
+		if err := c.Write(metric); err != nil || metric.Counter == nil {
+			return 0.0
 		}
+		return metric.Counter.GetValue()
+	}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+	return counterSum(counter, nil)
+}
 
-		var metric MessageMetrics
-		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
-			log.Error().Err(err).Msg("Failed to decode metrics payload")
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
+// counterSum returns the sum of the counter series whose labels match every entry of filter
+func counterSum(counter *prometheus.CounterVec, filter map[string]string) float64 {
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		counter.Collect(ch)
+		close(ch)
+	}()
+
+	value := 0.0
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil || m.Counter == nil {
+			continue
+		}
+		if matchLabels(m, filter) {
+			value += m.Counter.GetValue()
 		}
-
-		metric.Timestamp = time.Now()
-
-		// Update Prometheus metrics
-		ChatTokensCounter.WithLabelValues("input", "client").Add(float64(metric.TokensIn))
-		ChatTokensCounter.WithLabelValues("output", "client").Add(float64(metric.TokensOut))
-		ModelLatency.WithLabelValues("client", "inference").Observe(metric.ResponseTimeMs / 1000)
-		FirstTokenLatency.WithLabelValues("client").Observe(metric.FirstTokenTimeMs / 1000)
-
-		metricsMutex.Lock()
-		messageMetrics = append(messageMetrics, metric)
-		
-		// Record user activity
-		activeUserSessions[r.RemoteAddr] = time.Now()
-		metricsMutex.Unlock()
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "{\"success\": true}")
 	}
+	return value
 }
 
-// HandleLogError handles error logging from the frontend
-func HandleLogError() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.WriteHeader(http.StatusOK)
-			return
+// matchLabels reports whether the labels of m match every entry of filter
+func matchLabels(m *dto.Metric, filter map[string]string) bool {
+	for name, value := range filter {
+		found := false
+		for _, pair := range m.GetLabel() {
+			if pair.GetName() == name {
+				found = pair.GetValue() == value
+				break
+			}
 		}
-
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+		if !found {
+			return false
 		}
+	}
+	return true
+}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		var errorEntry ErrorLogEntry
-		if err := json.NewDecoder(r.Body).Decode(&errorEntry); err != nil {
-			log.Error().Err(err).Msg("Failed to decode error payload")
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
+// gaugeValue returns the value of a gauge
+func gaugeValue(gauge prometheus.Gauge) float64 {
+	metric := &dto.Metric{}
+	if err := gauge.Write(metric); err != nil || metric.Gauge == nil {
+		return 0.0
+	}
+	return metric.Gauge.GetValue()
+}
 
-		// Update Prometheus metrics
-		ErrorCounter.WithLabelValues(errorEntry.ErrorType, "frontend").Inc()
+// gaugeVecValue returns the value of the gauge series with labelValues
+func gaugeVecValue(gauge *prometheus.GaugeVec, labelValues ...string) float64 {
+	g, err := gauge.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		return 0.0
+	}
+	return gaugeValue(g)
+}
 
-		metricsMutex.Lock()
-		errorLogs = append(errorLogs, errorEntry)
-		metricsMutex.Unlock()
+// histogramAverage returns the mean observation of the histogram series with labelValues
+func histogramAverage(histogram *prometheus.HistogramVec, labelValues ...string) float64 {
+	h, err := histogram.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		return 0.0
+	}
 
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "{\"success\": true}")
+	metric := &dto.Metric{}
+	if err := h.(prometheus.Metric).Write(metric); err != nil || metric.Histogram == nil {
+		return 0.0
+	}
+	if metric.Histogram.GetSampleCount() == 0 {
+		return 0.0
 	}
+	return metric.Histogram.GetSampleSum() / float64(metric.Histogram.GetSampleCount())
 }
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Observation is the outcome of a single chat request
+type Observation struct {
+	Time       time.Time
+	Duration   time.Duration
+	FirstToken time.Duration // zero if no token was produced
+	TokensIn   int
+	TokensOut  int
+	Error      bool
+}
+
+// WindowSummary aggregates the observations of a time window
+type WindowSummary struct {
+	Window          string       `json:"window"`
+	Requests        int          `json:"requests"`
+	RequestRate     float64      `json:"requestRate"` // requests per second
+	Errors          int          `json:"errors"`
+	ErrorRate       float64      `json:"errorRate"`
+	TokensIn        int          `json:"tokensIn"`
+	TokensOut       int          `json:"tokensOut"`
+	TokensPerSecond float64      `json:"tokensPerSecond"` // output tokens per second of response time
+	ResponseTime    LatencyStats `json:"responseTime"`
+	FirstToken      LatencyStats `json:"timeToFirstToken"`
+}
+
+// windowSlot holds the aggregates of one interval
+type windowSlot struct {
+	epoch        int64
+	requests     int
+	errors       int
+	tokensIn     int
+	tokensOut    int
+	durationSum  float64
+	firstTokens  int
+	firstSum     float64
+	durationHist []uint64
+	firstHist    []uint64
+}
+
+// WindowStore keeps per-interval aggregates in a ring buffer so summaries can be
+// computed over recent windows instead of the process lifetime
+type WindowStore struct {
+	mu       sync.Mutex
+	interval time.Duration
+	bounds   []float64
+	slots    []windowSlot
+}
+
+// DefaultWindowBuckets are latency bucket bounds in seconds suited to chat requests
+var DefaultWindowBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60}
+
+// NewWindowStore creates a store with one slot per interval covering retention
+func NewWindowStore(interval, retention time.Duration, bounds []float64) *WindowStore {
+	n := int(retention / interval)
+	if retention%interval != 0 {
+		n++
+	}
+	// One extra slot so a full retention window is available mid-interval
+	return &WindowStore{
+		interval: interval,
+		bounds:   append(append([]float64{}, bounds...), math.Inf(1)),
+		slots:    make([]windowSlot, n+1),
+	}
+}
+
+// Retention returns the longest window the store can summarize
+func (s *WindowStore) Retention() time.Duration {
+	return time.Duration(len(s.slots)-1) * s.interval
+}
+
+// slot returns the slot for t, resetting it if it holds an older interval
+func (s *WindowStore) slot(t time.Time) *windowSlot {
+	epoch := t.UnixNano() / int64(s.interval)
+	slot := &s.slots[epoch%int64(len(s.slots))]
+	if slot.epoch != epoch {
+		*slot = windowSlot{
+			epoch:        epoch,
+			durationHist: make([]uint64, len(s.bounds)),
+			firstHist:    make([]uint64, len(s.bounds)),
+		}
+	}
+	return slot
+}
+
+// bucket returns the index of the first bound greater than or equal to v
+func (s *WindowStore) bucket(v float64) int {
+	for i, bound := range s.bounds {
+		if v <= bound {
+			return i
+		}
+	}
+	return len(s.bounds) - 1
+}
+
+// Record adds an observation to the interval it belongs to
+func (s *WindowStore) Record(o Observation) {
+	if o.Time.IsZero() {
+		o.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot := s.slot(o.Time)
+	slot.requests++
+	if o.Error {
+		slot.errors++
+	}
+	slot.tokensIn += o.TokensIn
+	slot.tokensOut += o.TokensOut
+
+	seconds := o.Duration.Seconds()
+	slot.durationSum += seconds
+	slot.durationHist[s.bucket(seconds)]++
+
+	if o.FirstToken > 0 {
+		first := o.FirstToken.Seconds()
+		slot.firstTokens++
+		slot.firstSum += first
+		slot.firstHist[s.bucket(first)]++
+	}
+}
+
+// Summary aggregates the slots that fall within window of now
+func (s *WindowStore) Summary(window time.Duration) WindowSummary {
+	now := time.Now()
+	oldest := now.Add(-window).UnixNano() / int64(s.interval)
+	newest := now.UnixNano() / int64(s.interval)
+
+	durations := &cumulativeHistogram{bounds: s.bounds, counts: make([]uint64, len(s.bounds))}
+	firsts := &cumulativeHistogram{bounds: s.bounds, counts: make([]uint64, len(s.bounds))}
+	summary := WindowSummary{Window: window.String()}
+
+	s.mu.Lock()
+	for i := range s.slots {
+		slot := &s.slots[i]
+		if slot.epoch < oldest || slot.epoch > newest || slot.requests == 0 {
+			continue
+		}
+		summary.Requests += slot.requests
+		summary.Errors += slot.errors
+		summary.TokensIn += slot.tokensIn
+		summary.TokensOut += slot.tokensOut
+
+		durations.count += uint64(slot.requests)
+		durations.sum += slot.durationSum
+		firsts.count += uint64(slot.firstTokens)
+		firsts.sum += slot.firstSum
+		for b := range s.bounds {
+			durations.counts[b] += slot.durationHist[b]
+			firsts.counts[b] += slot.firstHist[b]
+		}
+	}
+	s.mu.Unlock()
+
+	// The histograms were collected per bucket, the quantile estimation needs cumulative counts
+	for b := 1; b < len(s.bounds); b++ {
+		durations.counts[b] += durations.counts[b-1]
+		firsts.counts[b] += firsts.counts[b-1]
+	}
+
+	// The oldest slot starts up to one interval before now-window, so the rate
+	// is taken over the span the slots actually cover
+	covered := now.Sub(time.Unix(0, oldest*int64(s.interval)))
+	summary.RequestRate = float64(summary.Requests) / covered.Seconds()
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+	}
+	if durations.sum > 0 {
+		summary.TokensPerSecond = float64(summary.TokensOut) / durations.sum
+	}
+	summary.ResponseTime = durations.stats()
+	summary.FirstToken = firsts.stats()
+	return summary
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWindowSummaryExpiry(t *testing.T) {
+	store := NewWindowStore(time.Minute, time.Hour, DefaultWindowBuckets)
+	now := time.Now()
+	record := func(ago time.Duration, err bool) {
+		store.Record(Observation{
+			Time:       now.Add(-ago),
+			Duration:   time.Second,
+			FirstToken: 200 * time.Millisecond,
+			TokensIn:   10,
+			TokensOut:  20,
+			Error:      err,
+		})
+	}
+	record(30*time.Second, false)
+	record(3*time.Minute, true)
+	record(20*time.Minute, false)
+	record(2*time.Hour, false) // older than the retention
+
+	tests := []struct {
+		window    time.Duration
+		requests  int
+		errors    int
+		tokensOut int
+	}{
+		{time.Minute, 1, 0, 20},
+		{5 * time.Minute, 2, 1, 40},
+		{time.Hour, 3, 1, 60},
+	}
+	for _, tt := range tests {
+		s := store.Summary(tt.window)
+		if s.Requests != tt.requests || s.Errors != tt.errors || s.TokensOut != tt.tokensOut {
+			t.Errorf("window %s: requests %d, errors %d, tokens out %d, want %d, %d, %d",
+				tt.window, s.Requests, s.Errors, s.TokensOut, tt.requests, tt.errors, tt.tokensOut)
+		}
+		if s.ResponseTime.Count != uint64(tt.requests) || s.FirstToken.Count != uint64(tt.requests) {
+			t.Errorf("window %s: latency counts %d and %d, want %d", tt.window, s.ResponseTime.Count, s.FirstToken.Count, tt.requests)
+		}
+		if want := float64(tt.errors) / float64(tt.requests); s.ErrorRate != want {
+			t.Errorf("window %s: error rate %v, want %v", tt.window, s.ErrorRate, want)
+		}
+		// The rate is taken over the window plus the part of the oldest
+		// interval before it
+		if low, high := float64(tt.requests)/(tt.window+time.Minute).Seconds(), float64(tt.requests)/tt.window.Seconds(); s.RequestRate < low || s.RequestRate > high {
+			t.Errorf("window %s: request rate %v, want between %v and %v", tt.window, s.RequestRate, low, high)
+		}
+	}
+}
+
+func TestWindowSlotRollover(t *testing.T) {
+	store := NewWindowStore(time.Minute, 10*time.Minute, DefaultWindowBuckets)
+	if got := store.Retention(); got != 10*time.Minute {
+		t.Fatalf("retention = %s, want 10m", got)
+	}
+
+	// 11 slots, so a request 11 minutes ago shares the slot of the current
+	// minute and is replaced by the first request of this minute
+	now := time.Now()
+	store.Record(Observation{Time: now.Add(-11 * time.Minute), Duration: time.Second})
+	store.Record(Observation{Time: now, Duration: 3 * time.Second})
+
+	s := store.Summary(store.Retention())
+	if s.Requests != 1 {
+		t.Fatalf("requests = %d, want 1", s.Requests)
+	}
+	if math.Abs(s.ResponseTime.Average-3) > 1e-9 {
+		t.Errorf("average response time = %v, want 3", s.ResponseTime.Average)
+	}
+}
+
+func TestWindowSummaryEmpty(t *testing.T) {
+	s := NewWindowStore(time.Minute, time.Hour, DefaultWindowBuckets).Summary(5 * time.Minute)
+	if s.Requests != 0 || s.RequestRate != 0 || s.ErrorRate != 0 || s.TokensPerSecond != 0 || s.ResponseTime.P99 != 0 {
+		t.Errorf("summary of an empty store = %+v, want zeros", s)
+	}
+}
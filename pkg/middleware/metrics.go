@@ -5,16 +5,16 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
 )
 
 // MetricsMiddleware adds Prometheus metrics to HTTP requests
-func MetricsMiddleware(requestCounter *prometheus.CounterVec, requestDuration *prometheus.HistogramVec, activeRequests prometheus.Gauge) func(http.Handler) http.Handler {
+func MetricsMiddleware(rec *metrics.Recorder) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			activeRequests.Inc()
-			defer activeRequests.Dec()
+			rec.ActiveRequests.Inc()
+			defer rec.ActiveRequests.Dec()
 
 			// Wrap the response writer to capture status code
 			rww := &responseWriterWrapper{w: w, statusCode: http.StatusOK}
@@ -22,10 +22,42 @@ func MetricsMiddleware(requestCounter *prometheus.CounterVec, requestDuration *p
 			// Call the next handler
 			next.ServeHTTP(rww, r)
 
-			// Record metrics
+			// Record metrics by route template rather than raw path
 			duration := time.Since(start).Seconds()
-			requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
-			requestCounter.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(rww.statusCode)).Inc()
+			method, route := Method(r), Route(r)
+			durationLabels := rec.Labels.Values("genai_app_http_request_duration_seconds", method, route)
+			metrics.ObserveWithTrace(r.Context(), rec.RequestDuration.WithLabelValues(durationLabels...), duration)
+			counterLabels := rec.Labels.Values("genai_app_http_requests_total", method, route, strconv.Itoa(rww.statusCode))
+			rec.RequestCounter.WithLabelValues(counterLabels...).Inc()
 		})
 	}
 }
+
+// knownMethods are kept as label values, any other method is recorded as OTHER
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// Method returns the request method as a bounded label value
+func Method(r *http.Request) string {
+	if knownMethods[r.Method] {
+		return r.Method
+	}
+	return "OTHER"
+}
+
+// Route returns the ServeMux pattern that matched r, such as "/chat" or "/" for
+// the catch-all handler, so that scanned paths do not create new series. The
+// pattern is only known once the request went through the ServeMux.
+func Route(r *http.Request) string {
+	if r.Pattern == "" {
+		return metrics.OtherLabelValue
+	}
+	return r.Pattern
+}
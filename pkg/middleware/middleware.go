@@ -12,44 +12,49 @@ import (
 )
 
 // RequestLogger adds request logging middleware
-func RequestLogger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		requestID := uuid.New().String()
+func RequestLogger(rec *metrics.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID := uuid.New().String()
 
-		// Add request ID to context
-		ctx := r.Context()
-		r = r.WithContext(ctx)
+			// Add request ID to context
+			ctx := r.Context()
+			r = r.WithContext(ctx)
 
-		// Create a custom response writer to capture the status code
-		writer := &responseWriter{w, http.StatusOK}
+			// Create a custom response writer to capture the status code
+			writer := &responseWriter{w, http.StatusOK}
 
-		// Log the request
-		log.Info().Str("method", r.Method).Str("path", r.URL.Path).Str("request_id", requestID).Msg("Request started")
+			// Log the request
+			log.Info().Str("method", r.Method).Str("path", r.URL.Path).Str("request_id", requestID).Msg("Request started")
 
-		// Increment active requests counter
-		metrics.ActiveRequests.Inc()
+			// Increment active requests counter
+			rec.ActiveRequests.Inc()
 
-		// Call the next handler
-		next.ServeHTTP(writer, r)
+			// Call the next handler
+			next.ServeHTTP(writer, r)
 
-		// Decrement active requests counter
-		metrics.ActiveRequests.Dec()
+			// Decrement active requests counter
+			rec.ActiveRequests.Dec()
 
-		// Calculate request duration
-		duration := time.Since(start)
+			// Calculate request duration
+			duration := time.Since(start)
 
-		// Log the response
-		log.Info().Str("method", r.Method).Str("path", r.URL.Path).Int("status", writer.status).Dur("duration", duration).Str("request_id", requestID).Msg("Request completed")
+			// Log the response
+			log.Info().Str("method", r.Method).Str("path", r.URL.Path).Int("status", writer.status).Dur("duration", duration).Str("request_id", requestID).Msg("Request completed")
 
-		// Record metrics
-		metrics.RequestCounter.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(writer.status)).Inc()
-		metrics.RequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration.Seconds())
-	})
+			// Record metrics
+			method, route := Method(r), Route(r)
+			counterLabels := rec.Labels.Values("genai_app_http_requests_total", method, route, strconv.Itoa(writer.status))
+			rec.RequestCounter.WithLabelValues(counterLabels...).Inc()
+			durationLabels := rec.Labels.Values("genai_app_http_request_duration_seconds", method, route)
+			metrics.ObserveWithTrace(r.Context(), rec.RequestDuration.WithLabelValues(durationLabels...), duration.Seconds())
+		})
+	}
 }
 
 // RateLimiter implements a simple rate limiting middleware
-func RateLimiter(ratePerMinute int) func(http.Handler) http.Handler {
+func RateLimiter(rec *metrics.Recorder, ratePerMinute int) func(http.Handler) http.Handler {
 	// Create a map to track requests by IP
 	requestTracker := make(map[string][]time.Time)
 
@@ -71,7 +76,7 @@ func RateLimiter(ratePerMinute int) func(http.Handler) http.Handler {
 
 			// Check if the client has exceeded the rate limit
 			if len(requestTimes) >= ratePerMinute {
-				metrics.ErrorCounter.WithLabelValues("rate_limit", "api").Inc()
+				rec.RecordError(Route(r), metrics.ErrorRateLimited)
 				log.Warn().Str("ip", ipAddress).Int("rate_limit", ratePerMinute).Msg("Rate limit exceeded")
 				http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 				return
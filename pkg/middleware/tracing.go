@@ -4,10 +4,15 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// TraceIDHeader carries the trace ID of a request back to the client
+const TraceIDHeader = "X-Trace-Id"
+
 // TracingMiddleware adds OpenTelemetry tracing to HTTP requests
 func TracingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -17,10 +22,18 @@ func TracingMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Start a new span for this request
-		ctx, span := tracing.StartSpan(r.Context(), "http_request")
+		// Continue the caller's trace from its traceparent header, or start a new one
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer("genai-app").Start(ctx, "http_request", trace.WithSpanKind(trace.SpanKindServer))
 		defer span.End()
 
+		// Return the trace ID so clients can look the request up in Jaeger, only
+		// for sampled traces since the others may never be exported
+		if spanContext := span.SpanContext(); spanContext.IsSampled() {
+			w.Header().Set(TraceIDHeader, spanContext.TraceID().String())
+			w.Header().Add("Access-Control-Expose-Headers", TraceIDHeader)
+		}
+
 		// Add request attributes to the span
 		span.SetAttributes(
 			attribute.String("http.method", r.Method),
@@ -0,0 +1,89 @@
+// Package pricing estimates the cost and energy of chat requests from token counts.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Price is the cost of a model per 1K tokens and, optionally, its power draw
+type Price struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+	// Watts is the average power drawn while the model generates; energy is
+	// Watts multiplied by the inference time in seconds
+	Watts float64 `json:"watts,omitempty"`
+}
+
+// Table maps model names to prices
+type Table struct {
+	Currency string           `json:"currency"`
+	Default  *Price           `json:"default,omitempty"`
+	Models   map[string]Price `json:"models"`
+}
+
+// Estimate is the cost and energy of a single request
+type Estimate struct {
+	InputCost    float64 `json:"input_cost"`
+	OutputCost   float64 `json:"output_cost"`
+	Cost         float64 `json:"cost"`
+	EnergyJoules float64 `json:"energy_joules"`
+	Currency     string  `json:"currency"`
+}
+
+// Load reads a pricing table from a JSON file
+func Load(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing table: %w", err)
+	}
+
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing table: %w", err)
+	}
+	if table.Currency == "" {
+		table.Currency = "USD"
+	}
+	return &table, nil
+}
+
+// Lookup finds the price for a model. Tags are ignored as a fallback, so
+// "ai/llama3.2" also prices "ai/llama3.2:1B-Q8_0".
+func (t *Table) Lookup(model string) (Price, bool) {
+	if t == nil {
+		return Price{}, false
+	}
+	if price, ok := t.Models[model]; ok {
+		return price, true
+	}
+	if i := strings.LastIndex(model, ":"); i > 0 {
+		if price, ok := t.Models[model[:i]]; ok {
+			return price, true
+		}
+	}
+	if t.Default != nil {
+		return *t.Default, true
+	}
+	return Price{}, false
+}
+
+// Estimate computes the cost of a request from its token counts and inference time
+func (t *Table) Estimate(model string, tokensIn, tokensOut int, inference time.Duration) Estimate {
+	price, ok := t.Lookup(model)
+	if !ok {
+		return Estimate{}
+	}
+
+	estimate := Estimate{
+		InputCost:    float64(tokensIn) / 1000 * price.InputPer1K,
+		OutputCost:   float64(tokensOut) / 1000 * price.OutputPer1K,
+		EnergyJoules: price.Watts * inference.Seconds(),
+		Currency:     t.Currency,
+	}
+	estimate.Cost = estimate.InputCost + estimate.OutputCost
+	return estimate
+}
@@ -0,0 +1,324 @@
+// Package rules generates Prometheus recording and alerting rules from the
+// metrics the application registers, so the rules fail to generate instead of
+// silently matching nothing when a metric is renamed.
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/anomaly"
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/ajeetraina/genai-app-demo/pkg/slo"
+)
+
+// Rule is a Prometheus recording or alerting rule
+type Rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Group is a named list of rules evaluated together
+type Group struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// File is the content of a Prometheus rule file
+type File struct {
+	Groups []Group `yaml:"groups"`
+}
+
+// Options tune the generated rules
+type Options struct {
+	// Job is the scrape job of the application, used by the availability alert
+	Job string
+	// RateWindow is the range of the rate() calls, such as 5m
+	RateWindow string
+	// Quantiles are recorded for every histogram labelled by model
+	Quantiles []float64
+	// ErrorRatio is the fraction of failed chats that raises an alert
+	ErrorRatio float64
+	// ExcludeInjected leaves the errors caused by the fault injector out of
+	// the chat error ratio
+	ExcludeInjected bool
+	// TTFTRegression raises an alert when the p90 time to first token of a
+	// model is this many times higher than a day earlier
+	TTFTRegression float64
+	// MaxActiveRequests is the number of requests in flight considered saturated
+	MaxActiveRequests int
+	// AnomalyScore is the anomaly score, in standard deviations, that raises an alert
+	AnomalyScore float64
+	// Objectives get multi-window burn rate alerts
+	Objectives []slo.Objective
+}
+
+// DefaultOptions matches prometheus/prometheus.yml and the default SLOs
+func DefaultOptions() Options {
+	return Options{
+		Job:               "genai-app",
+		RateWindow:        "5m",
+		Quantiles:         []float64{0.5, 0.9, 0.99},
+		ErrorRatio:        0.05,
+		TTFTRegression:    1.5,
+		MaxActiveRequests: 20,
+		AnomalyScore:      anomaly.DefaultConfig().Threshold,
+		Objectives:        slo.DefaultConfig().Objectives,
+	}
+}
+
+// Metric families the hand-written rules depend on
+const (
+	httpRequests     = "genai_app_http_requests_total"
+	errorsTotal      = "genai_app_errors_total"
+	firstToken       = "genai_app_first_token_latency_seconds"
+	upstreamRequests = "genai_app_upstream_requests_total"
+	activeRequests   = "genai_app_active_requests"
+	sloBurnRate      = "genai_app_slo_burn_rate"
+	anomalyScore     = "genai_app_anomaly_score"
+)
+
+// generator collects the rules and the metrics they are missing
+type generator struct {
+	inv     *metrics.Inventory
+	opts    Options
+	missing []string
+}
+
+// Generate builds the recording and alerting rules for the families in inv.
+// It fails when a family the rules depend on is not registered.
+func Generate(inv *metrics.Inventory, opts Options) (File, error) {
+	g := &generator{inv: inv, opts: opts}
+	file := File{Groups: []Group{
+		{Name: "genai_app_recording", Rules: g.recordingRules()},
+		{Name: "genai_app_alerts", Rules: g.alertingRules()},
+	}}
+	if len(opts.Objectives) > 0 {
+		file.Groups = append(file.Groups, Group{Name: "genai_app_slo", Rules: g.sloRules()})
+	}
+	if len(g.missing) > 0 {
+		return file, fmt.Errorf("rules depend on metrics that are not registered: %s", strings.Join(g.missing, ", "))
+	}
+	return file, nil
+}
+
+// require reports whether the family is registered with the labels, and
+// remembers it as missing otherwise
+func (g *generator) require(name string, labels ...string) bool {
+	family, ok := g.inv.Family(name)
+	if !ok {
+		g.missing = append(g.missing, name)
+		return false
+	}
+	for _, label := range labels {
+		if !family.HasLabel(label) {
+			g.missing = append(g.missing, fmt.Sprintf("%s{%s}", name, label))
+			return false
+		}
+	}
+	return true
+}
+
+// recordName builds a recording rule name following the level:metric:operations convention
+func recordName(labels []string, metric, operation string) string {
+	level := "genai_app"
+	if len(labels) > 0 {
+		level = strings.Join(labels, "_")
+	}
+	return level + ":" + metric + ":" + operation
+}
+
+// recordingRules precompute per-model rates and percentiles, and the ratios used by the alerts
+func (g *generator) recordingRules() []Rule {
+	w := g.opts.RateWindow
+	var rules []Rule
+
+	if g.require(httpRequests, "endpoint", "status") {
+		rules = append(rules, Rule{
+			Record: recordName([]string{"endpoint", "status"}, "genai_app_http_requests", "rate"+w),
+			Expr:   fmt.Sprintf("sum by (endpoint, status) (rate(%s[%s]))", httpRequests, w),
+		})
+	}
+	if g.require(httpRequests, "method", "endpoint") && g.require(errorsTotal, "type", "endpoint") {
+		selector := fmt.Sprintf("endpoint=%q", metrics.ChatEndpoint)
+		if g.opts.ExcludeInjected {
+			selector += `, type!~"injected_.*"`
+		}
+		rules = append(rules, Rule{
+			Record: g.chatErrorRatio(),
+			Expr: fmt.Sprintf(`sum(rate(%s{%s}[%s])) / sum(rate(%s{method="POST", endpoint=%q}[%s]))`,
+				errorsTotal, selector, w, httpRequests, metrics.ChatEndpoint, w),
+		})
+	}
+	if g.require(upstreamRequests, "status") {
+		rules = append(rules, Rule{
+			Record: g.upstreamErrorRatio(),
+			Expr: fmt.Sprintf(`sum(rate(%s{status=~"5..|error"}[%s])) / sum(rate(%s[%s]))`,
+				upstreamRequests, w, upstreamRequests, w),
+		})
+	}
+
+	// Every family labelled by model gets per-model rates or percentiles,
+	// keeping its other labels
+	for _, family := range g.inv.Families() {
+		if !family.HasLabel("model") {
+			continue
+		}
+		switch family.Type {
+		case metrics.TypeCounter:
+			rules = append(rules, Rule{
+				Record: recordName(family.Labels, strings.TrimSuffix(family.Name, "_total"), "rate"+w),
+				Expr:   fmt.Sprintf("sum by (%s) (rate(%s[%s]))", strings.Join(family.Labels, ", "), family.Name, w),
+			})
+		case metrics.TypeHistogram:
+			for _, q := range g.opts.Quantiles {
+				rules = append(rules, Rule{
+					Record: recordName(family.Labels, family.Name, quantileName(q)+"_rate"+w),
+					Expr: fmt.Sprintf("histogram_quantile(%s, sum by (%s, le) (rate(%s_bucket[%s])))",
+						strconv.FormatFloat(q, 'f', -1, 64), strings.Join(family.Labels, ", "), family.Name, w),
+				})
+			}
+		}
+	}
+	return rules
+}
+
+// quantileName turns 0.99 into p99 and 0.999 into p999
+func quantileName(q float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(math.Round(q*1000)/10, 'f', -1, 64), ".", "")
+}
+
+func (g *generator) chatErrorRatio() string {
+	return recordName(nil, "chat_errors", "ratio_rate"+g.opts.RateWindow)
+}
+
+func (g *generator) upstreamErrorRatio() string {
+	return recordName(nil, "upstream_errors", "ratio_rate"+g.opts.RateWindow)
+}
+
+// alertingRules cover errors, latency regressions, availability, saturation and anomalies
+func (g *generator) alertingRules() []Rule {
+	w := g.opts.RateWindow
+	var rules []Rule
+
+	if g.require(httpRequests) && g.require(errorsTotal) {
+		rules = append(rules, Rule{
+			Alert:  "GenAIAppHighErrorRate",
+			Expr:   fmt.Sprintf("%s > %s", g.chatErrorRatio(), formatFloat(g.opts.ErrorRatio)),
+			For:    "10m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Chat error rate is high",
+				"description": fmt.Sprintf("{{ $value | humanizePercentage }} of chat requests failed over the last %s.", w),
+			},
+		})
+	}
+
+	if g.require(firstToken, "model") {
+		p90 := "histogram_quantile(0.9, sum by (model, le) (rate(%s_bucket[%s]%s)))"
+		rules = append(rules, Rule{
+			Alert: "GenAIAppTTFTRegression",
+			Expr: fmt.Sprintf(p90+" > %s * "+p90,
+				firstToken, w, "", formatFloat(g.opts.TTFTRegression), firstToken, w, " offset 1d"),
+			For:    "15m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Time to first token regressed for {{ $labels.model }}",
+				"description": fmt.Sprintf("p90 time to first token is {{ $value | humanizeDuration }}, over %sx the same time yesterday.", formatFloat(g.opts.TTFTRegression)),
+			},
+		})
+	}
+
+	rules = append(rules, Rule{
+		Alert:  "GenAIAppBackendDown",
+		Expr:   fmt.Sprintf("up{job=%q} == 0", g.opts.Job),
+		For:    "1m",
+		Labels: map[string]string{"severity": "critical"},
+		Annotations: map[string]string{
+			"summary":     "GenAI app backend is down",
+			"description": "Prometheus cannot scrape {{ $labels.instance }}.",
+		},
+	})
+
+	if g.require(upstreamRequests, "status") {
+		rules = append(rules, Rule{
+			Alert: "GenAIAppModelBackendDown",
+			Expr: fmt.Sprintf(`(sum(rate(%s{status=~"2.."}[%s])) or vector(0)) == 0 and sum(rate(%s[%s])) > 0`,
+				upstreamRequests, w, upstreamRequests, w),
+			For:    "2m",
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "The model backend is not answering",
+				"description": fmt.Sprintf("No model backend request succeeded over the last %s.", w),
+			},
+		})
+	}
+
+	if g.require(activeRequests) {
+		rules = append(rules, Rule{
+			Alert:  "GenAIAppSaturated",
+			Expr:   fmt.Sprintf("%s > %d", activeRequests, g.opts.MaxActiveRequests),
+			For:    "5m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Requests are queuing up",
+				"description": "{{ $value }} requests have been in flight for 5 minutes.",
+			},
+		})
+	}
+
+	if g.require(anomalyScore, "model", "signal") {
+		rules = append(rules, Rule{
+			Alert:  "GenAIAppAnomaly",
+			Expr:   fmt.Sprintf("%s > %s", anomalyScore, formatFloat(g.opts.AnomalyScore)),
+			For:    "5m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "{{ $labels.signal }} of {{ $labels.model }} deviates from its baseline",
+				"description": "{{ $labels.signal }} is {{ $value | humanize }} standard deviations worse than the baseline of {{ $labels.model }}.",
+			},
+		})
+	}
+	return rules
+}
+
+// sloRules page or open a ticket when an objective burns its error budget
+// too fast over both a long and a short window
+func (g *generator) sloRules() []Rule {
+	if !g.require(sloBurnRate, "slo", "window") {
+		return nil
+	}
+	var rules []Rule
+	for _, o := range g.opts.Objectives {
+		for _, a := range o.BurnAlerts() {
+			threshold := formatFloat(a.Threshold)
+			rules = append(rules, Rule{
+				Alert: "GenAIAppErrorBudgetBurn",
+				Expr: fmt.Sprintf(`%s{slo=%q, window=%q} > %s and on (slo) %s{slo=%q, window=%q} > %s`,
+					sloBurnRate, o.Name, a.LongWindow, threshold, sloBurnRate, o.Name, a.ShortWindow, threshold),
+				For: "2m",
+				Labels: map[string]string{
+					"severity":    a.Severity,
+					"slo":         o.Name,
+					"long_window": a.LongWindow,
+				},
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("%s is burning its error budget", o.Name),
+					"description": fmt.Sprintf("The error budget of %s is spent {{ $value | humanize }} times faster than allowed over %s and %s.",
+						o.Name, a.LongWindow, a.ShortWindow),
+				},
+			})
+		}
+	}
+	return rules
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
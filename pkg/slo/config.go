@@ -0,0 +1,138 @@
+// Package slo evaluates service level objectives against chat outcomes in
+// process and reports their compliance, remaining error budget and burn rates.
+package slo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Indicators measured by an objective
+const (
+	// IndicatorAvailability counts the requests that did not fail on the server side
+	IndicatorAvailability = "availability"
+	// IndicatorFirstToken counts the successful requests whose first token
+	// arrived within the threshold
+	IndicatorFirstToken = "time_to_first_token"
+	// IndicatorResponseTime counts the successful requests that completed
+	// within the threshold
+	IndicatorResponseTime = "response_time"
+)
+
+// maxWindow bounds the compliance window kept in memory
+const maxWindow = 90 * 24 * time.Hour
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Duration is a time.Duration written as a string such as "720h" in JSON
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("a duration must be a string such as \"720h\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Objective is one service level objective
+type Objective struct {
+	// Name identifies the objective in the slo label, in snake case
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Indicator is availability, time_to_first_token or response_time
+	Indicator string `json:"indicator"`
+	// ThresholdMs is the latency a request must stay under for latency indicators
+	ThresholdMs float64 `json:"threshold_ms,omitempty"`
+	// Target is the fraction of good requests to reach, such as 0.95
+	Target float64 `json:"target"`
+	// Window is the rolling period the target applies to
+	Window Duration `json:"window"`
+}
+
+// Config lists the objectives to track
+type Config struct {
+	Objectives []Objective `json:"objectives"`
+}
+
+// DefaultConfig promises a time to first token under 1s for 95% of chats and
+// 99% availability, both over 30 days
+func DefaultConfig() Config {
+	return Config{
+		Objectives: []Objective{
+			{
+				Name:        "chat_ttft",
+				Description: "95% of chats receive their first token within 1s",
+				Indicator:   IndicatorFirstToken,
+				ThresholdMs: 1000,
+				Target:      0.95,
+				Window:      Duration(30 * 24 * time.Hour),
+			},
+			{
+				Name:        "chat_availability",
+				Description: "99% of chats complete without a server error",
+				Indicator:   IndicatorAvailability,
+				Target:      0.99,
+				Window:      Duration(30 * 24 * time.Hour),
+			},
+		},
+	}
+}
+
+// LoadConfig reads the objectives from a JSON file, replacing the defaults
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read SLO config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse SLO config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the objectives can be tracked
+func (c Config) Validate() error {
+	names := make(map[string]bool)
+	for _, o := range c.Objectives {
+		if !namePattern.MatchString(o.Name) {
+			return fmt.Errorf("invalid objective name %q, use lowercase letters, digits and underscores", o.Name)
+		}
+		if names[o.Name] {
+			return fmt.Errorf("duplicate objective %q", o.Name)
+		}
+		names[o.Name] = true
+
+		switch o.Indicator {
+		case IndicatorAvailability:
+		case IndicatorFirstToken, IndicatorResponseTime:
+			if o.ThresholdMs <= 0 {
+				return fmt.Errorf("objective %s needs a positive threshold_ms", o.Name)
+			}
+		default:
+			return fmt.Errorf("objective %s has unknown indicator %q, use availability, time_to_first_token or response_time", o.Name, o.Indicator)
+		}
+		if o.Target <= 0 || o.Target >= 1 {
+			return fmt.Errorf("objective %s target %v is outside (0, 1)", o.Name, o.Target)
+		}
+		if window := time.Duration(o.Window); window < time.Hour || window > maxWindow {
+			return fmt.Errorf("objective %s window must be between 1h and %s", o.Name, maxWindow)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Report is returned by /slo
+type Report struct {
+	Objectives []Status `json:"objectives"`
+}
+
+// HandleSLO returns the current state of every objective for the dashboard
+func (t *Tracker) HandleSLO() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Report{Objectives: t.Statuses()}); err != nil {
+			log.Error().Err(err).Msg("Failed to encode SLO report")
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package slo
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// interval is the resolution of the rolling windows
+const interval = time.Minute
+
+// burnWindow is a window over which the burn rate is reported
+type burnWindow struct {
+	name     string
+	duration time.Duration
+}
+
+// burnWindows are the windows of the multi-window burn rate alerts below.
+// Windows longer than an objective's window are skipped.
+var burnWindows = []burnWindow{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"2h", 2 * time.Hour},
+	{"6h", 6 * time.Hour},
+	{"1d", 24 * time.Hour},
+	{"3d", 72 * time.Hour},
+}
+
+// BurnAlert fires when the burn rate exceeds Threshold over both a long and a
+// short window, so it triggers quickly and stops soon after recovery
+type BurnAlert struct {
+	Severity    string  `json:"severity"`
+	LongWindow  string  `json:"long_window"`
+	ShortWindow string  `json:"short_window"`
+	Threshold   float64 `json:"threshold"`
+}
+
+// burnAlerts are the pairs recommended by the Google SRE workbook for a 30 day
+// window. They fire once 2%, 5%, 10% and 10% of the budget are spent over
+// their long window.
+var burnAlerts = []BurnAlert{
+	{"page", "1h", "5m", 14.4},
+	{"page", "6h", "30m", 6},
+	{"ticket", "1d", "2h", 3},
+	{"ticket", "3d", "6h", 1},
+}
+
+// burnAlertsWindow is the objective window burnAlerts are tuned for
+const burnAlertsWindow = 30 * 24 * time.Hour
+
+// BurnAlerts returns the burn rate alerts whose windows fit in the objective
+// window. The thresholds are scaled to the objective window, so each alert
+// fires after spending the same fraction of the budget as over 30 days.
+func (o Objective) BurnAlerts() []BurnAlert {
+	scale := float64(o.Window) / float64(burnAlertsWindow)
+	var alerts []BurnAlert
+	for _, a := range burnAlerts {
+		for _, w := range burnWindows {
+			if w.name == a.LongWindow && w.duration <= time.Duration(o.Window) {
+				a.Threshold = math.Round(a.Threshold*scale*1000) / 1000
+				alerts = append(alerts, a)
+			}
+		}
+	}
+	return alerts
+}
+
+// Outcome is the result of one chat request
+type Outcome struct {
+	Time         time.Time
+	ResponseTime time.Duration
+	// FirstToken is zero when no token was received
+	FirstToken time.Duration
+	// ErrorType is empty for a successful request
+	ErrorType string
+}
+
+// BurnRate is how fast the error budget is spent over a window, 1 spends it
+// exactly by the end of the objective window
+type BurnRate struct {
+	Window string  `json:"window"`
+	Rate   float64 `json:"rate"`
+	Total  int     `json:"total"`
+}
+
+// Alert is the state of a multi-window burn rate alert
+type Alert struct {
+	BurnAlert
+	Firing bool `json:"firing"`
+}
+
+// Status is the current state of an objective
+type Status struct {
+	Objective
+	Good  int `json:"good"`
+	Total int `json:"total"`
+	// Compliance is the fraction of good requests over the window, 1 without requests
+	Compliance float64 `json:"compliance"`
+	// ErrorBudgetRemaining is the unspent fraction of the allowed bad
+	// requests, negative once the budget is exhausted
+	ErrorBudgetRemaining float64    `json:"error_budget_remaining"`
+	Met                  bool       `json:"met"`
+	BurnRates            []BurnRate `json:"burn_rates"`
+	Alerts               []Alert    `json:"alerts"`
+}
+
+// slot counts the requests of one interval
+type slot struct {
+	epoch int64
+	good  int
+	total int
+}
+
+// tracked is an objective with its rolling counts
+type tracked struct {
+	Objective
+	slots []slot
+}
+
+// Gauges computed by the Tracker when it is collected
+var (
+	targetFamily = metrics.Family{
+		Name:   "genai_app_slo_target",
+		Help:   "Fraction of good requests the objective promises",
+		Type:   metrics.TypeGauge,
+		Labels: []string{"slo"},
+	}
+	complianceFamily = metrics.Family{
+		Name:   "genai_app_slo_compliance",
+		Help:   "Fraction of good requests over the objective window",
+		Type:   metrics.TypeGauge,
+		Labels: []string{"slo"},
+	}
+	budgetFamily = metrics.Family{
+		Name:   "genai_app_slo_error_budget_remaining",
+		Help:   "Unspent fraction of the error budget over the objective window",
+		Type:   metrics.TypeGauge,
+		Labels: []string{"slo"},
+	}
+	burnRateFamily = metrics.Family{
+		Name:   "genai_app_slo_burn_rate",
+		Help:   "Rate at which the error budget is spent over a window, 1 exhausts it at the end of the objective window",
+		Type:   metrics.TypeGauge,
+		Labels: []string{"slo", "window"},
+	}
+)
+
+// Tracker evaluates every objective against chat outcomes. Its gauges are
+// computed when Prometheus scrapes them. Counts are kept in memory, so the
+// windows start over when the process restarts.
+type Tracker struct {
+	mu         sync.Mutex
+	objectives []*tracked
+
+	events         *prometheus.CounterVec
+	targetDesc     *prometheus.Desc
+	complianceDesc *prometheus.Desc
+	budgetDesc     *prometheus.Desc
+	burnRateDesc   *prometheus.Desc
+}
+
+// NewTracker tracks the objectives of a validated cfg and registers its
+// metrics with reg. A nil reg uses the Prometheus default registerer.
+func NewTracker(cfg Config, reg prometheus.Registerer) *Tracker {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	t := &Tracker{
+		events: metrics.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "genai_app_slo_events_total",
+				Help: "Chat requests evaluated against each service level objective, by result (good or bad)",
+			},
+			[]string{"slo", "result"},
+		),
+		targetDesc:     targetFamily.Desc(),
+		complianceDesc: complianceFamily.Desc(),
+		budgetDesc:     budgetFamily.Desc(),
+		burnRateDesc:   burnRateFamily.Desc(),
+	}
+	for _, o := range cfg.Objectives {
+		n := int(time.Duration(o.Window) / interval)
+		// One extra slot so a full window is available mid-interval
+		t.objectives = append(t.objectives, &tracked{Objective: o, slots: make([]slot, n+1)})
+	}
+	reg.MustRegister(t)
+	return t
+}
+
+// Record evaluates an outcome against every objective. Requests rejected as
+// invalid and streams cut by the client are not counted, they say nothing
+// about the service. A nil Tracker discards outcomes.
+func (t *Tracker) Record(o Outcome) {
+	if t == nil {
+		return
+	}
+	if o.ErrorType == metrics.ErrorClientInput || o.ErrorType == metrics.ErrorStreamInterrupted {
+		return
+	}
+	if o.Time.IsZero() {
+		o.Time = time.Now()
+	}
+	epoch := o.Time.UnixNano() / int64(interval)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, obj := range t.objectives {
+		good, counted := obj.evaluate(o)
+		if !counted {
+			continue
+		}
+		s := &obj.slots[epoch%int64(len(obj.slots))]
+		if s.epoch != epoch {
+			*s = slot{epoch: epoch}
+		}
+		s.total++
+		result := "bad"
+		if good {
+			s.good++
+			result = "good"
+		}
+		t.events.WithLabelValues(obj.Name, result).Inc()
+	}
+}
+
+// evaluate reports whether o is good for the objective and whether it counts at all
+func (obj *tracked) evaluate(o Outcome) (good, counted bool) {
+	if obj.Indicator == IndicatorAvailability {
+		return o.ErrorType == "", true
+	}
+	// Latency objectives only apply to successful requests, failures are
+	// covered by availability
+	if o.ErrorType != "" {
+		return false, false
+	}
+	latency := o.ResponseTime
+	if obj.Indicator == IndicatorFirstToken && o.FirstToken > 0 {
+		latency = o.FirstToken
+	}
+	return float64(latency.Microseconds())/1000 <= obj.ThresholdMs, true
+}
+
+// Statuses returns the current state of every objective
+func (t *Tracker) Statuses() []Status {
+	now := time.Now()
+	statuses := make([]Status, 0, len(t.objectives))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, obj := range t.objectives {
+		statuses = append(statuses, obj.status(now))
+	}
+	return statuses
+}
+
+// status sums the slots of the objective window and of each burn rate window
+// in a single pass
+func (obj *tracked) status(now time.Time) Status {
+	window := time.Duration(obj.Window)
+	var windows []burnWindow
+	for _, w := range burnWindows {
+		if w.duration <= window {
+			windows = append(windows, w)
+		}
+	}
+
+	newest := now.UnixNano() / int64(interval)
+	oldest := now.Add(-window).UnixNano() / int64(interval)
+	oldestBurn := make([]int64, len(windows))
+	for i, w := range windows {
+		oldestBurn[i] = now.Add(-w.duration).UnixNano() / int64(interval)
+	}
+
+	status := Status{Objective: obj.Objective}
+	good := make([]int, len(windows))
+	total := make([]int, len(windows))
+	for _, s := range obj.slots {
+		if s.epoch < oldest || s.epoch > newest || s.total == 0 {
+			continue
+		}
+		status.Good += s.good
+		status.Total += s.total
+		for i := range windows {
+			if s.epoch >= oldestBurn[i] {
+				good[i] += s.good
+				total[i] += s.total
+			}
+		}
+	}
+
+	budget := 1 - obj.Target
+	status.Compliance = 1
+	if status.Total > 0 {
+		status.Compliance = float64(status.Good) / float64(status.Total)
+	}
+	status.ErrorBudgetRemaining = 1 - (1-status.Compliance)/budget
+	status.Met = status.Compliance >= obj.Target
+
+	rates := make(map[string]float64, len(windows))
+	for i, w := range windows {
+		rate := 0.0
+		if total[i] > 0 {
+			rate = float64(total[i]-good[i]) / float64(total[i]) / budget
+		}
+		rates[w.name] = rate
+		status.BurnRates = append(status.BurnRates, BurnRate{Window: w.name, Rate: rate, Total: total[i]})
+	}
+	for _, a := range obj.BurnAlerts() {
+		status.Alerts = append(status.Alerts, Alert{
+			BurnAlert: a,
+			Firing:    rates[a.LongWindow] > a.Threshold && rates[a.ShortWindow] > a.Threshold,
+		})
+	}
+	return status
+}
+
+// Families implements metrics.FamilyDescriber
+func (t *Tracker) Families() []metrics.Family {
+	return []metrics.Family{targetFamily, complianceFamily, budgetFamily, burnRateFamily}
+}
+
+// Describe implements prometheus.Collector
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.targetDesc
+	ch <- t.complianceDesc
+	ch <- t.budgetDesc
+	ch <- t.burnRateDesc
+}
+
+// Collect implements prometheus.Collector
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range t.Statuses() {
+		ch <- prometheus.MustNewConstMetric(t.targetDesc, prometheus.GaugeValue, s.Target, s.Name)
+		ch <- prometheus.MustNewConstMetric(t.complianceDesc, prometheus.GaugeValue, s.Compliance, s.Name)
+		ch <- prometheus.MustNewConstMetric(t.budgetDesc, prometheus.GaugeValue, s.ErrorBudgetRemaining, s.Name)
+		for _, b := range s.BurnRates {
+			ch <- prometheus.MustNewConstMetric(t.burnRateDesc, prometheus.GaugeValue, b.Rate, s.Name, b.Window)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBurnAlerts(t *testing.T) {
+	tests := []struct {
+		window time.Duration
+		want   []BurnAlert
+	}{
+		{30 * 24 * time.Hour, []BurnAlert{
+			{"page", "1h", "5m", 14.4},
+			{"page", "6h", "30m", 6},
+			{"ticket", "1d", "2h", 3},
+			{"ticket", "3d", "6h", 1},
+		}},
+		{7 * 24 * time.Hour, []BurnAlert{
+			{"page", "1h", "5m", 3.36},
+			{"page", "6h", "30m", 1.4},
+			{"ticket", "1d", "2h", 0.7},
+			{"ticket", "3d", "6h", 0.233},
+		}},
+		{24 * time.Hour, []BurnAlert{
+			{"page", "1h", "5m", 0.48},
+			{"page", "6h", "30m", 0.2},
+			{"ticket", "1d", "2h", 0.1},
+		}},
+		{2 * time.Hour, []BurnAlert{
+			{"page", "1h", "5m", 0.04},
+		}},
+	}
+	for _, tt := range tests {
+		got := Objective{Window: Duration(tt.window)}.BurnAlerts()
+		if len(got) != len(tt.want) {
+			t.Errorf("window %s: got %d alerts %v, want %v", tt.window, len(got), got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("window %s: alert %d = %+v, want %+v", tt.window, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func newTestTracker(window time.Duration) *Tracker {
+	return NewTracker(Config{Objectives: []Objective{{
+		Name:      "availability",
+		Indicator: IndicatorAvailability,
+		Target:    0.9,
+		Window:    Duration(window),
+	}}}, prometheus.NewRegistry())
+}
+
+func TestStatusBurnRates(t *testing.T) {
+	tr := newTestTracker(30 * 24 * time.Hour)
+	now := time.Now()
+
+	// 4 bad out of 10 in the last 5 minutes, 10 good a few hours earlier
+	for i := 0; i < 10; i++ {
+		errorType := ""
+		if i < 4 {
+			errorType = metrics.ErrorUpstream5xx
+		}
+		tr.Record(Outcome{Time: now.Add(-2 * time.Minute), ErrorType: errorType})
+		tr.Record(Outcome{Time: now.Add(-3 * time.Hour)})
+	}
+	// Not counted at all
+	tr.Record(Outcome{Time: now.Add(-time.Minute), ErrorType: metrics.ErrorClientInput})
+
+	status := tr.objectives[0].status(now)
+	if status.Good != 16 || status.Total != 20 {
+		t.Fatalf("good/total = %d/%d, want 16/20", status.Good, status.Total)
+	}
+	if status.Met {
+		t.Error("objective met with a compliance of 0.8 and a target of 0.9")
+	}
+	if got, want := status.ErrorBudgetRemaining, -1.0; !near(got, want) {
+		t.Errorf("error budget remaining = %v, want %v", got, want)
+	}
+
+	want := map[string]struct {
+		rate  float64
+		total int
+	}{
+		"5m":  {4, 10},
+		"30m": {4, 10},
+		"1h":  {4, 10},
+		"2h":  {4, 10},
+		"6h":  {2, 20},
+		"1d":  {2, 20},
+		"3d":  {2, 20},
+	}
+	for _, b := range status.BurnRates {
+		w := want[b.Window]
+		if !near(b.Rate, w.rate) || b.Total != w.total {
+			t.Errorf("burn rate over %s = %v (%d requests), want %v (%d requests)", b.Window, b.Rate, b.Total, w.rate, w.total)
+		}
+	}
+	if len(status.BurnRates) != len(want) {
+		t.Errorf("got %d burn rates, want %d", len(status.BurnRates), len(want))
+	}
+
+	// Only the last ticket alert has both windows over its threshold, the
+	// short burst stays under the others
+	for _, a := range status.Alerts {
+		firing := a.LongWindow == "3d"
+		if a.Firing != firing {
+			t.Errorf("alert %s/%s firing = %v, want %v", a.LongWindow, a.ShortWindow, a.Firing, firing)
+		}
+	}
+}
+
+func TestSlotRollover(t *testing.T) {
+	tr := newTestTracker(time.Hour)
+	start := time.Now().Truncate(interval)
+
+	tr.Record(Outcome{Time: start, ErrorType: metrics.ErrorUpstream5xx})
+	if s := tr.objectives[0].status(start); s.Total != 1 || s.Good != 0 {
+		t.Fatalf("good/total = %d/%d, want 0/1", s.Good, s.Total)
+	}
+
+	// The window has 61 slots, so this lands in the slot of the first
+	// request and replaces it
+	later := start.Add(61 * interval)
+	tr.Record(Outcome{Time: later})
+	if s := tr.objectives[0].status(later); s.Total != 1 || s.Good != 1 {
+		t.Errorf("after rollover good/total = %d/%d, want 1/1", s.Good, s.Total)
+	}
+
+	// Requests older than the window are no longer counted
+	if s := tr.objectives[0].status(later.Add(2 * time.Hour)); s.Total != 0 || s.Compliance != 1 {
+		t.Errorf("after expiry total = %d compliance = %v, want 0 and 1", s.Total, s.Compliance)
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket per client. Buckets idle long enough to be full
+// again are dropped so the map stays bounded by the active clients.
+type limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(perMinute int) *limiter {
+	return &limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		clients: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of client and reports whether one was left
+func (l *limiter) allow(client string, now time.Time) bool {
+	if l.burst <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now)
+	}
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops the buckets that have refilled, l.mu must be held
+func (l *limiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.clients {
+		if now.Sub(b.last) > refill {
+			delete(l.clients, client)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,65 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestLimiterRefill(t *testing.T) {
+	// A burst of 60 refilled at one token per second
+	l := newLimiter(60)
+	tests := []struct {
+		name    string
+		after   time.Duration
+		client  string
+		n       int
+		allowed int
+	}{
+		{"burst", 0, "a", 61, 60},
+		{"empty bucket", 0, "a", 1, 0},
+		{"other client", 0, "b", 1, 1},
+		{"half a second", 500 * time.Millisecond, "a", 1, 0},
+		{"one second", time.Second, "a", 2, 1},
+		{"ten seconds", 11 * time.Second, "a", 20, 10},
+		// The bucket never holds more than the burst
+		{"an hour", time.Hour + 11*time.Second, "a", 100, 60},
+	}
+	for _, tt := range tests {
+		now := start.Add(tt.after)
+		allowed := 0
+		for i := 0; i < tt.n; i++ {
+			if l.allow(tt.client, now) {
+				allowed++
+			}
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: allowed %d of %d reports, want %d", tt.name, allowed, tt.n, tt.allowed)
+		}
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := newLimiter(0)
+	for i := 0; i < 1000; i++ {
+		if !l.allow("a", start) {
+			t.Fatalf("report %d rejected with rate limiting disabled", i)
+		}
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := newLimiter(60)
+	l.allow("idle", start)
+	l.allow("active", start.Add(30*time.Second))
+
+	// The idle bucket refilled after 60s, the active one has not yet
+	l.allow("active", start.Add(61*time.Second))
+	if _, ok := l.clients["idle"]; ok {
+		t.Error("refilled bucket kept")
+	}
+	if _, ok := l.clients["active"]; !ok {
+		t.Error("active bucket dropped")
+	}
+}
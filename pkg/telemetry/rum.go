@@ -0,0 +1,107 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RUM beacon event types
+const (
+	EventFirstTokenRendered = "first_token_rendered"
+	EventStreamComplete     = "stream_complete"
+	EventAborted            = "aborted"
+)
+
+// maxBeacons bounds the beacons accepted in one batch
+const maxBeacons = 20
+
+// Beacon is a single browser event for a chat request, identified by the trace
+// ID the server returned in X-Trace-Id
+type Beacon struct {
+	TraceID string `json:"trace_id"`
+	Type    string `json:"type"`
+	// ElapsedMs is the time from sending the request to the event, measured in the browser
+	ElapsedMs float64 `json:"elapsed_ms"`
+}
+
+// BeaconBatch is the body of a /rum request
+type BeaconBatch struct {
+	Beacons []Beacon `json:"beacons"`
+}
+
+// Validate checks the batch against the schema bounds
+func (b BeaconBatch) Validate() error {
+	if len(b.Beacons) == 0 || len(b.Beacons) > maxBeacons {
+		return fmt.Errorf("a batch must hold between 1 and %d beacons", maxBeacons)
+	}
+	for _, beacon := range b.Beacons {
+		if _, err := trace.TraceIDFromHex(beacon.TraceID); err != nil {
+			return fmt.Errorf("trace_id must be 32 lowercase hex digits")
+		}
+		switch beacon.Type {
+		case EventFirstTokenRendered, EventStreamComplete, EventAborted:
+		default:
+			return fmt.Errorf("unknown beacon type %q", beacon.Type)
+		}
+		if beacon.ElapsedMs < 0 || beacon.ElapsedMs > maxLatencyMs {
+			return fmt.Errorf("elapsed_ms must be between 0 and %d", maxLatencyMs)
+		}
+	}
+	return nil
+}
+
+// HandleRUM accepts batches of Real-User-Monitoring beacons sent with
+// navigator.sendBeacon. Each event is observed as client latency, compared with
+// the server measurement of the same trace, and added to that trace as a span
+// running from the start of the request to the moment the browser saw the event.
+func (i *Ingestor) HandleRUM() http.HandlerFunc {
+	return i.handle(func(w http.ResponseWriter, req *http.Request) (string, error) {
+		var batch BeaconBatch
+		if err := i.decode(w, req, &batch); err != nil {
+			return ResultInvalid, err
+		}
+		if err := batch.Validate(); err != nil {
+			return ResultInvalid, err
+		}
+
+		for _, beacon := range batch.Beacons {
+			server, duplicate := i.traces.recordClient(beacon.TraceID, beacon.Type, time.Now())
+			if duplicate {
+				continue
+			}
+			i.recordBeacon(beacon, server)
+		}
+		return ResultAccepted, nil
+	})
+}
+
+// recordBeacon records one browser event, server is nil when the trace is unknown
+func (i *Ingestor) recordBeacon(beacon Beacon, server *ServerMeasurement) {
+	elapsed := beacon.ElapsedMs / 1000
+	i.rec.ClientLatency.WithLabelValues(beacon.Type).Observe(elapsed)
+	if server == nil {
+		return
+	}
+
+	switch beacon.Type {
+	case EventFirstTokenRendered:
+		if server.FirstToken > 0 {
+			i.observeOverhead(beacon.Type, elapsed, server.FirstToken)
+		}
+	case EventStreamComplete:
+		i.observeOverhead(beacon.Type, elapsed, server.ResponseTime)
+	}
+
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), server.Span)
+	tracing.RecordSpan(ctx, "rum."+beacon.Type,
+		server.Start, server.Start.Add(time.Duration(beacon.ElapsedMs*float64(time.Millisecond))),
+		attribute.String("rum.event", beacon.Type),
+		attribute.Float64("rum.elapsed_ms", beacon.ElapsedMs),
+	)
+}
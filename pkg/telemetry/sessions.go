@@ -0,0 +1,110 @@
+package telemetry
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxSessions bounds the chat requests remembered for correlation
+const maxSessions = 10_000
+
+// ServerMeasurement is what the server measured for a chat request
+type ServerMeasurement struct {
+	RequestID string
+	// Span is the server span of the request, client events are recorded under it
+	Span         trace.SpanContext
+	Start        time.Time
+	ResponseTime time.Duration
+	FirstToken   time.Duration
+	TokensIn     int
+	TokensOut    int
+}
+
+// session links a message or trace ID to the server measurement of its chat
+// request and remembers what the client already reported for it
+type session struct {
+	server   *ServerMeasurement
+	reported map[string]bool
+	created  time.Time
+}
+
+// sessions keeps recent message or trace IDs for correlation and deduplication
+type sessions struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	byID      map[string]*session
+	lastSweep time.Time
+}
+
+func newSessions(ttl time.Duration) *sessions {
+	return &sessions{ttl: ttl, byID: make(map[string]*session)}
+}
+
+// recordServer stores the server measurement for id. It reports false when
+// the store is full.
+func (s *sessions) recordServer(id string, m ServerMeasurement, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.get(id, now)
+	if !ok {
+		return false
+	}
+	sess.server = &m
+	return true
+}
+
+// recordClient marks a report of kind for id as received and returns the
+// server measurement to compare with, if any. duplicate is true when the
+// client already sent that kind of report for id. Only IDs the server
+// recorded are tracked, so clients cannot fill the store with made-up IDs.
+func (s *sessions) recordClient(id, kind string, now time.Time) (server *ServerMeasurement, duplicate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.lookup(id, now)
+	if !ok {
+		return nil, false
+	}
+	if sess.reported[kind] {
+		return nil, true
+	}
+	sess.reported[kind] = true
+	return sess.server, false
+}
+
+// get returns the session for id, creating it when there is room. s.mu must
+// be held.
+func (s *sessions) get(id string, now time.Time) (*session, bool) {
+	if sess, ok := s.lookup(id, now); ok {
+		return sess, true
+	}
+	if len(s.byID) >= maxSessions {
+		return nil, false
+	}
+	sess := &session{reported: make(map[string]bool), created: now}
+	s.byID[id] = sess
+	return sess, true
+}
+
+// lookup returns the session for id if there is one, s.mu must be held
+func (s *sessions) lookup(id string, now time.Time) (*session, bool) {
+	if now.Sub(s.lastSweep) > s.ttl/10 {
+		s.sweep(now)
+	}
+	sess, ok := s.byID[id]
+	return sess, ok
+}
+
+// sweep forgets sessions older than the TTL, s.mu must be held
+func (s *sessions) sweep(now time.Time) {
+	for id, sess := range s.byID {
+		if now.Sub(sess.created) > s.ttl {
+			delete(s.byID, id)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,257 @@
+// Package telemetry ingests the measurements reported by the frontend. Reports
+// are checked against a schema with bounds, rate limited per client, and
+// correlated by message ID with the server-side measurements of the same chat
+// request so both sides can be compared without counting a request twice.
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Report outcomes used as the result label of genai_app_telemetry_reports_total
+const (
+	ResultAccepted    = "accepted"
+	ResultInvalid     = "invalid"
+	ResultDuplicate   = "duplicate"
+	ResultRateLimited = "rate_limited"
+	ResultForbidden   = "forbidden"
+)
+
+// Config controls the ingestion limits
+type Config struct {
+	// RatePerMinute is the number of reports a client may send per minute,
+	// 0 disables rate limiting
+	RatePerMinute int
+	// AllowedOrigins lists the browser origins allowed to report, empty allows any
+	AllowedOrigins []string
+	// Retention is how long message IDs are remembered for correlation and dedup
+	Retention time.Duration
+	// MaxBodyBytes caps the size of a report
+	MaxBodyBytes int64
+}
+
+// DefaultConfig returns limits suited to the bundled frontend
+func DefaultConfig() Config {
+	return Config{
+		RatePerMinute: 60,
+		Retention:     10 * time.Minute,
+		MaxBodyBytes:  4096,
+	}
+}
+
+// Ingestor validates frontend reports and records them into the Recorder
+type Ingestor struct {
+	rec      *metrics.Recorder
+	model    string
+	cfg      Config
+	limiter  *limiter
+	sessions *sessions
+	traces   *sessions
+}
+
+// NewIngestor creates an Ingestor for reports about model
+func NewIngestor(rec *metrics.Recorder, model string, cfg Config) *Ingestor {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultConfig().Retention
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultConfig().MaxBodyBytes
+	}
+	return &Ingestor{
+		rec:      rec,
+		model:    model,
+		cfg:      cfg,
+		limiter:  newLimiter(cfg.RatePerMinute),
+		sessions: newSessions(cfg.Retention),
+		traces:   newSessions(cfg.Retention),
+	}
+}
+
+// RecordServer stores the server measurement of a chat request so that the
+// client reports for it can be compared, by messageID for /metrics/log and by
+// the trace ID of m.Span for RUM beacons. Only sampled traces are returned to
+// the browser, so only those are kept for RUM. messageID may be empty.
+func (i *Ingestor) RecordServer(messageID string, m ServerMeasurement) {
+	now := time.Now()
+	if ValidateMessageID(messageID) == nil && !i.sessions.recordServer(messageID, m, now) {
+		log.Warn().Str("message_id", messageID).Msg("Telemetry session store full, not correlating request")
+	}
+	if m.Span.IsSampled() && !i.traces.recordServer(m.Span.TraceID().String(), m, now) {
+		log.Warn().Str("trace_id", m.Span.TraceID().String()).Msg("Telemetry trace store full, not correlating request")
+	}
+}
+
+// HandleLogMetrics records the latencies measured by the frontend for a chat
+// request. Repeated reports for a message ID the server remembers are ignored.
+func (i *Ingestor) HandleLogMetrics() http.HandlerFunc {
+	return i.handle(func(w http.ResponseWriter, req *http.Request) (string, error) {
+		var report MetricLog
+		if err := i.decode(w, req, &report); err != nil {
+			return ResultInvalid, err
+		}
+		if err := report.Validate(); err != nil {
+			return ResultInvalid, err
+		}
+
+		server, duplicate := i.sessions.recordClient(report.MessageID, "metrics_log", time.Now())
+		if duplicate {
+			return ResultDuplicate, nil
+		}
+
+		responseTime := report.ResponseTimeMs / 1000
+		firstToken := report.FirstTokenMs / 1000
+		i.rec.ClientLatency.WithLabelValues("response_time").Observe(responseTime)
+		if firstToken > 0 {
+			i.rec.ClientLatency.WithLabelValues("first_token").Observe(firstToken)
+		}
+
+		if server != nil {
+			i.observeOverhead("response_time", responseTime, server.ResponseTime)
+			if firstToken > 0 && server.FirstToken > 0 {
+				i.observeOverhead("first_token", firstToken, server.FirstToken)
+			}
+			log.Debug().
+				Str("message_id", report.MessageID).
+				Str("request_id", server.RequestID).
+				Float64("client_response_ms", report.ResponseTimeMs).
+				Float64("server_response_ms", float64(server.ResponseTime.Microseconds())/1000).
+				Int("client_tokens_out", report.TokensOut).
+				Int("server_tokens_out", server.TokensOut).
+				Msg("Correlated client telemetry")
+		}
+		return ResultAccepted, nil
+	})
+}
+
+// HandleLogError records errors reported by the frontend. They are kept apart from
+// the server-side error taxonomy since most of them describe failures the server
+// already counted.
+func (i *Ingestor) HandleLogError() http.HandlerFunc {
+	return i.handle(func(w http.ResponseWriter, req *http.Request) (string, error) {
+		var report ErrorLog
+		if err := i.decode(w, req, &report); err != nil {
+			return ResultInvalid, err
+		}
+		if err := report.Validate(); err != nil {
+			return ResultInvalid, err
+		}
+
+		i.rec.FrontendErrorCounter.WithLabelValues(report.ErrorType).Inc()
+		return ResultAccepted, nil
+	})
+}
+
+// HandleLlamaCppMetrics records llama.cpp metrics reported by the frontend
+func (i *Ingestor) HandleLlamaCppMetrics() http.HandlerFunc {
+	return i.handle(func(w http.ResponseWriter, req *http.Request) (string, error) {
+		var report metrics.LlamaCppMetrics
+		if err := i.decode(w, req, &report); err != nil {
+			return ResultInvalid, err
+		}
+		if err := ValidateLlamaCpp(report); err != nil {
+			return ResultInvalid, err
+		}
+
+		i.rec.RecordLlamaCppMetrics(i.model, report)
+		return ResultAccepted, nil
+	})
+}
+
+// handle wraps an ingestion endpoint with CORS, origin and rate limit checks,
+// and counts the outcome of every report
+func (i *Ingestor) handle(ingest func(w http.ResponseWriter, req *http.Request) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if !i.originAllowed(origin) {
+			i.reject(w, req, ResultForbidden, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		if len(i.cfg.AllowedOrigins) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !i.limiter.allow(clientKey(req), time.Now()) {
+			i.reject(w, req, ResultRateLimited, "Too many telemetry reports", http.StatusTooManyRequests)
+			return
+		}
+
+		result, err := ingest(w, req)
+		if err != nil {
+			i.reject(w, req, result, "Invalid report: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		i.rec.TelemetryReports.WithLabelValues(req.URL.Path, result).Inc()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// decode parses a report, rejecting unknown fields and oversized bodies
+func (i *Ingestor) decode(w http.ResponseWriter, req *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, i.cfg.MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return errors.New("body too large")
+		}
+		return err
+	}
+	return nil
+}
+
+func (i *Ingestor) reject(w http.ResponseWriter, req *http.Request, result, message string, status int) {
+	i.rec.TelemetryReports.WithLabelValues(req.URL.Path, result).Inc()
+	log.Debug().Str("path", req.URL.Path).Str("client", clientKey(req)).Str("result", result).Msg(message)
+	http.Error(w, message, status)
+}
+
+// observeOverhead records how much longer the client measured than the server.
+// Negative differences come from clock granularity and are counted as zero.
+func (i *Ingestor) observeOverhead(measurement string, client float64, server time.Duration) {
+	i.rec.ClientOverhead.WithLabelValues(measurement).Observe(max(0, client-server.Seconds()))
+}
+
+// originAllowed reports whether a browser origin may send reports. Requests
+// without an Origin header do not come from a browser and are allowed.
+func (i *Ingestor) originAllowed(origin string) bool {
+	if origin == "" || len(i.cfg.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range i.cfg.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientKey identifies the client for rate limiting by its IP address
+func clientKey(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHandleLogMetricsRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		result string
+	}{
+		{"accepted", `{"message_id": "m1", "tokens_out": 5, "response_time_ms": 900, "time_to_first_token_ms": 100}`, http.StatusOK, ResultAccepted},
+		{"duplicate", `{"message_id": "m1", "tokens_out": 5, "response_time_ms": 900}`, http.StatusOK, ResultDuplicate},
+		{"unknown field", `{"message_id": "m2", "cost": 1}`, http.StatusBadRequest, ResultInvalid},
+		{"not json", `tokens=5`, http.StatusBadRequest, ResultInvalid},
+		{"body too large", `{"message_id": "` + strings.Repeat("a", 5000) + `"}`, http.StatusBadRequest, ResultInvalid},
+		{"out of bounds", `{"message_id": "m3", "tokens_in": -1}`, http.StatusBadRequest, ResultInvalid},
+		{"rate limited", `{"message_id": "m4"}`, http.StatusTooManyRequests, ResultRateLimited},
+	}
+
+	rec := metrics.NewRecorder(prometheus.NewRegistry())
+	cfg := DefaultConfig()
+	cfg.RatePerMinute = len(tests) - 1
+	ingestor := NewIngestor(rec, "m", cfg)
+	// Repeated reports are only recognised for chats the server remembers
+	ingestor.RecordServer("m1", ServerMeasurement{})
+	handler := ingestor.HandleLogMetrics()
+
+	for _, tt := range tests {
+		before := testutil.ToFloat64(rec.TelemetryReports.WithLabelValues("/metrics/log", tt.result))
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/metrics/log", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := testutil.ToFloat64(rec.TelemetryReports.WithLabelValues("/metrics/log", tt.result)) - before; got != 1 {
+			t.Errorf("%s: %s reports went up by %v, want 1", tt.name, tt.result, got)
+		}
+	}
+}
+
+func TestHandleOriginAllowlist(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowedOrigins = []string{"http://localhost:3000"}
+	handler := NewIngestor(metrics.NewRecorder(prometheus.NewRegistry()), "m", cfg).HandleLogError()
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"http://localhost:3000", http.StatusOK},
+		{"HTTP://LOCALHOST:3000", http.StatusOK},
+		{"", http.StatusOK},
+		{"http://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/metrics/error", strings.NewReader(`{"error_type": "api_error", "status_code": 500}`))
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != tt.status {
+			t.Errorf("origin %q: status = %d, want %d", tt.origin, w.Code, tt.status)
+		}
+	}
+}
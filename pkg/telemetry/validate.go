@@ -0,0 +1,110 @@
+package telemetry
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+)
+
+// Bounds applied to reported values. Anything outside them is rejected rather
+// than clamped, since it points at a broken or hostile client.
+const (
+	maxTokens         = 1_000_000
+	maxLatencyMs      = 10 * 60 * 1000
+	maxInputLength    = 1_000_000
+	maxContextSize    = 1 << 20
+	maxTokensPerSec   = 10_000
+	maxMemoryPerToken = 1 << 30
+	maxThreads        = 1024
+	maxBatchSize      = 1 << 16
+	maxModelTypeLen   = 64
+)
+
+// messageIDPattern restricts message IDs to short, log-safe identifiers
+var messageIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// errorTypes are the error types the frontend reports. They become label
+// values, so unknown types are rejected.
+var errorTypes = map[string]bool{
+	"api_error":     true,
+	"network_error": true,
+	"stream_error":  true,
+}
+
+// MetricLog represents a metrics log entry sent by the frontend
+type MetricLog struct {
+	MessageID      string  `json:"message_id"`
+	TokensIn       int     `json:"tokens_in"`
+	TokensOut      int     `json:"tokens_out"`
+	ResponseTimeMs float64 `json:"response_time_ms"`
+	FirstTokenMs   float64 `json:"time_to_first_token_ms"`
+}
+
+// Validate checks the entry against the schema bounds
+func (m MetricLog) Validate() error {
+	if err := ValidateMessageID(m.MessageID); err != nil {
+		return err
+	}
+	if m.TokensIn < 0 || m.TokensIn > maxTokens || m.TokensOut < 0 || m.TokensOut > maxTokens {
+		return fmt.Errorf("token counts must be between 0 and %d", maxTokens)
+	}
+	if m.ResponseTimeMs < 0 || m.ResponseTimeMs > maxLatencyMs {
+		return fmt.Errorf("response_time_ms must be between 0 and %d", maxLatencyMs)
+	}
+	if m.FirstTokenMs < 0 || m.FirstTokenMs > m.ResponseTimeMs {
+		return fmt.Errorf("time_to_first_token_ms must be between 0 and response_time_ms")
+	}
+	return nil
+}
+
+// ErrorLog represents an error log entry sent by the frontend
+type ErrorLog struct {
+	ErrorType   string `json:"error_type"`
+	StatusCode  int    `json:"status_code"`
+	InputLength int    `json:"input_length"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// Validate checks the entry against the schema bounds
+func (e ErrorLog) Validate() error {
+	if !errorTypes[e.ErrorType] {
+		return fmt.Errorf("unknown error_type %q", e.ErrorType)
+	}
+	if e.StatusCode != 0 && (e.StatusCode < 100 || e.StatusCode > 599) {
+		return fmt.Errorf("status_code must be 0 or a valid HTTP status")
+	}
+	if e.InputLength < 0 || e.InputLength > maxInputLength {
+		return fmt.Errorf("input_length must be between 0 and %d", maxInputLength)
+	}
+	return nil
+}
+
+// ValidateLlamaCpp checks llama.cpp metrics against the schema bounds
+func ValidateLlamaCpp(m metrics.LlamaCppMetrics) error {
+	switch {
+	case m.ContextSize < 1 || m.ContextSize > maxContextSize:
+		return fmt.Errorf("context_size must be between 1 and %d", maxContextSize)
+	case m.PromptEvalTime < 0 || m.PromptEvalTime > maxLatencyMs:
+		return fmt.Errorf("prompt_eval_time_ms must be between 0 and %d", maxLatencyMs)
+	case m.TokensPerSecond < 0 || m.TokensPerSecond > maxTokensPerSec:
+		return fmt.Errorf("tokens_per_second must be between 0 and %d", maxTokensPerSec)
+	case m.MemoryPerToken < 0 || m.MemoryPerToken > maxMemoryPerToken:
+		return fmt.Errorf("memory_per_token_bytes must be between 0 and %d", maxMemoryPerToken)
+	case m.ThreadsUsed < 0 || m.ThreadsUsed > maxThreads:
+		return fmt.Errorf("threads_used must be between 0 and %d", maxThreads)
+	case m.BatchSize < 0 || m.BatchSize > maxBatchSize:
+		return fmt.Errorf("batch_size must be between 0 and %d", maxBatchSize)
+	case len(m.ModelType) > maxModelTypeLen:
+		return fmt.Errorf("model_type must be at most %d characters", maxModelTypeLen)
+	}
+	return nil
+}
+
+// ValidateMessageID checks that id can be used to correlate reports
+func ValidateMessageID(id string) error {
+	if !messageIDPattern.MatchString(id) {
+		return fmt.Errorf("message_id must be 1 to 64 letters, digits or ._:-")
+	}
+	return nil
+}
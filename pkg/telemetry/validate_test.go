@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
+)
+
+func TestMetricLogValidate(t *testing.T) {
+	valid := MetricLog{MessageID: "msg-1", TokensIn: 10, TokensOut: 20, ResponseTimeMs: 1500, FirstTokenMs: 200}
+	tests := []struct {
+		name  string
+		edit  func(m *MetricLog)
+		valid bool
+	}{
+		{"valid", func(m *MetricLog) {}, true},
+		{"no first token", func(m *MetricLog) { m.FirstTokenMs = 0 }, true},
+		{"first token at the end", func(m *MetricLog) { m.FirstTokenMs = m.ResponseTimeMs }, true},
+		{"largest values", func(m *MetricLog) {
+			m.TokensIn, m.TokensOut, m.ResponseTimeMs = maxTokens, maxTokens, maxLatencyMs
+		}, true},
+		{"missing message id", func(m *MetricLog) { m.MessageID = "" }, false},
+		{"message id with spaces", func(m *MetricLog) { m.MessageID = "a b" }, false},
+		{"long message id", func(m *MetricLog) { m.MessageID = strings.Repeat("a", 65) }, false},
+		{"negative tokens in", func(m *MetricLog) { m.TokensIn = -1 }, false},
+		{"too many tokens out", func(m *MetricLog) { m.TokensOut = maxTokens + 1 }, false},
+		{"negative response time", func(m *MetricLog) { m.ResponseTimeMs = -1 }, false},
+		{"response time too long", func(m *MetricLog) { m.ResponseTimeMs = maxLatencyMs + 1 }, false},
+		{"negative first token", func(m *MetricLog) { m.FirstTokenMs = -1 }, false},
+		{"first token after the response", func(m *MetricLog) { m.FirstTokenMs = m.ResponseTimeMs + 1 }, false},
+	}
+	for _, tt := range tests {
+		m := valid
+		tt.edit(&m)
+		if err := m.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestErrorLogValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   ErrorLog
+		valid bool
+	}{
+		{"api error", ErrorLog{ErrorType: "api_error", StatusCode: 503, InputLength: 12}, true},
+		{"network error without status", ErrorLog{ErrorType: "network_error"}, true},
+		{"stream error", ErrorLog{ErrorType: "stream_error", StatusCode: 200}, true},
+		{"unknown type", ErrorLog{ErrorType: "oops"}, false},
+		{"type in another case", ErrorLog{ErrorType: "API_ERROR"}, false},
+		{"status below 100", ErrorLog{ErrorType: "api_error", StatusCode: 99}, false},
+		{"status above 599", ErrorLog{ErrorType: "api_error", StatusCode: 600}, false},
+		{"negative input length", ErrorLog{ErrorType: "api_error", InputLength: -1}, false},
+		{"input too long", ErrorLog{ErrorType: "api_error", InputLength: maxInputLength + 1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.log.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateLlamaCpp(t *testing.T) {
+	valid := metrics.LlamaCppMetrics{
+		ContextSize:     4096,
+		PromptEvalTime:  120,
+		TokensPerSecond: 35,
+		MemoryPerToken:  1024,
+		ThreadsUsed:     8,
+		BatchSize:       512,
+		ModelType:       "llama",
+	}
+	tests := []struct {
+		name  string
+		edit  func(m *metrics.LlamaCppMetrics)
+		valid bool
+	}{
+		{"valid", func(m *metrics.LlamaCppMetrics) {}, true},
+		{"largest context", func(m *metrics.LlamaCppMetrics) { m.ContextSize = maxContextSize }, true},
+		{"no context", func(m *metrics.LlamaCppMetrics) { m.ContextSize = 0 }, false},
+		{"context too large", func(m *metrics.LlamaCppMetrics) { m.ContextSize = maxContextSize + 1 }, false},
+		{"negative prompt eval time", func(m *metrics.LlamaCppMetrics) { m.PromptEvalTime = -1 }, false},
+		{"prompt eval time too long", func(m *metrics.LlamaCppMetrics) { m.PromptEvalTime = maxLatencyMs + 1 }, false},
+		{"too many tokens per second", func(m *metrics.LlamaCppMetrics) { m.TokensPerSecond = maxTokensPerSec + 1 }, false},
+		{"negative memory per token", func(m *metrics.LlamaCppMetrics) { m.MemoryPerToken = -1 }, false},
+		{"too many threads", func(m *metrics.LlamaCppMetrics) { m.ThreadsUsed = maxThreads + 1 }, false},
+		{"negative batch size", func(m *metrics.LlamaCppMetrics) { m.BatchSize = -1 }, false},
+		{"long model type", func(m *metrics.LlamaCppMetrics) { m.ModelType = strings.Repeat("x", maxModelTypeLen+1) }, false},
+	}
+	for _, tt := range tests {
+		m := valid
+		tt.edit(&m)
+		if err := ValidateLlamaCpp(m); (err == nil) != tt.valid {
+			t.Errorf("%s: ValidateLlamaCpp() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package tracing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Trace exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterNone   = "none"
+)
+
+// OTLP transport protocols
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// Config controls how traces are sampled and where they are exported. It can
+// be loaded from a JSON file and overridden by environment variables.
+type Config struct {
+	// Exporter is otlp, stdout, file or none
+	Exporter string `json:"exporter"`
+	// Protocol is the OTLP transport, http or grpc
+	Protocol string `json:"protocol"`
+	// Endpoint is the host:port of the OTLP receiver
+	Endpoint string `json:"endpoint"`
+	// Insecure disables TLS for the OTLP connection
+	Insecure bool `json:"insecure"`
+	// Headers are sent with every OTLP export, e.g. for authentication
+	Headers map[string]string `json:"headers,omitempty"`
+	// CAFile verifies the receiver certificate instead of the system roots
+	CAFile string `json:"ca_file,omitempty"`
+	// CertFile and KeyFile are the client certificate for mutual TLS
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// File receives the spans as JSON when Exporter is file
+	File string `json:"file,omitempty"`
+
+	// SampleRatio is the fraction of new traces kept. Traces started by a
+	// caller follow the caller's sampling decision.
+	SampleRatio float64 `json:"sample_ratio"`
+	// KeepErrors keeps every trace containing a failed span, whatever the ratio
+	KeepErrors bool `json:"keep_errors"`
+	// SlowThresholdMs keeps every trace whose root span took at least this
+	// long, 0 disables it
+	SlowThresholdMs int `json:"slow_threshold_ms"`
+	// BatchTimeoutMs is the longest time spans wait before being exported
+	BatchTimeoutMs int `json:"batch_timeout_ms"`
+}
+
+// DefaultConfig exports every trace to a local Jaeger over plain OTLP/HTTP
+func DefaultConfig() Config {
+	return Config{
+		Exporter:       ExporterOTLP,
+		Protocol:       ProtocolHTTP,
+		Endpoint:       "jaeger:4318",
+		Insecure:       true,
+		File:           "traces.json",
+		SampleRatio:    1,
+		BatchTimeoutMs: 5000,
+	}
+}
+
+// LoadConfig reads a configuration file on top of the defaults
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read tracing config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse tracing config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// ApplyEnv overrides the configuration with the environment variables found
+// by lookup, normally os.LookupEnv
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	stringVars := map[string]*string{
+		"TRACING_EXPORTER": &c.Exporter,
+		"TRACING_PROTOCOL": &c.Protocol,
+		"TRACING_FILE":     &c.File,
+		"OTLP_ENDPOINT":    &c.Endpoint,
+		"OTLP_CA_FILE":     &c.CAFile,
+		"OTLP_CERT_FILE":   &c.CertFile,
+		"OTLP_KEY_FILE":    &c.KeyFile,
+	}
+	for key, field := range stringVars {
+		if v, ok := lookup(key); ok && v != "" {
+			*field = v
+		}
+	}
+
+	if v, ok := lookup("OTLP_INSECURE"); ok && v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid OTLP_INSECURE: %w", err)
+		}
+		c.Insecure = insecure
+	}
+	if v, ok := lookup("OTLP_HEADERS"); ok && v != "" {
+		headers, err := parseHeaders(v)
+		if err != nil {
+			return err
+		}
+		c.Headers = headers
+	}
+	if v, ok := lookup("TRACING_SAMPLE_RATIO"); ok && v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid TRACING_SAMPLE_RATIO: %w", err)
+		}
+		c.SampleRatio = ratio
+	}
+	if v, ok := lookup("TRACING_KEEP_ERRORS"); ok && v != "" {
+		keep, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid TRACING_KEEP_ERRORS: %w", err)
+		}
+		c.KeepErrors = keep
+	}
+	intVars := map[string]*int{
+		"TRACING_SLOW_THRESHOLD_MS": &c.SlowThresholdMs,
+		"TRACING_BATCH_TIMEOUT_MS":  &c.BatchTimeoutMs,
+	}
+	for key, field := range intVars {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*field = n
+		}
+	}
+	return c.Validate()
+}
+
+// Validate checks that the configuration can be used
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterOTLP, ExporterStdout, ExporterFile, ExporterNone:
+	default:
+		return fmt.Errorf("unknown trace exporter %q, use otlp, stdout, file or none", c.Exporter)
+	}
+	if c.Exporter == ExporterOTLP && c.Protocol != ProtocolHTTP && c.Protocol != ProtocolGRPC {
+		return fmt.Errorf("unknown OTLP protocol %q, use http or grpc", c.Protocol)
+	}
+	if c.Exporter == ExporterFile && c.File == "" {
+		return fmt.Errorf("the file trace exporter needs a file")
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("sample ratio %v is outside [0, 1]", c.SampleRatio)
+	}
+	if c.SlowThresholdMs < 0 || c.BatchTimeoutMs <= 0 {
+		return fmt.Errorf("the slow threshold must not be negative and the batch timeout must be positive")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("a client certificate needs both a cert and a key file")
+	}
+	return nil
+}
+
+// tailSampling reports whether traces are buffered to keep errors and slow requests
+func (c Config) tailSampling() bool {
+	return c.KeepErrors || c.SlowThresholdMs > 0
+}
+
+// TLSConfig builds the TLS settings for the OTLP connection, nil when the
+// defaults are enough
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if c.CAFile == "" && c.CertFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// parseHeaders parses "key=value" pairs separated by commas
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q, use key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
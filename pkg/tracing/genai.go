@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconvgenai "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GenAI operation names as defined by the OpenTelemetry GenAI semantic conventions
+const (
+	GenAIOperationChat       = "chat"
+	GenAIOperationEmbeddings = "embeddings"
+)
+
+// GenAISystem is the gen_ai.system of the backends the app talks to. Docker Model
+// Runner and llama.cpp are called through their OpenAI-compatible API.
+const GenAISystem = "openai"
+
+// GenAIUsageEstimatedKey marks token counts the app estimated because the
+// backend did not report its usage. It is not part of the semantic conventions.
+const GenAIUsageEstimatedKey = "genai_app.usage.estimated"
+
+// StartGenAISpan starts a client span for a call to the model backend with the
+// conventional "{operation} {model}" name and request attributes
+func StartGenAISpan(ctx context.Context, operation, model string) (context.Context, trace.Span) {
+	return otel.Tracer("genai-app").Start(ctx,
+		operation+" "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(GenAIRequestAttributes(operation, model)...),
+	)
+}
+
+// GenAIRequestAttributes describes a request to the model backend
+func GenAIRequestAttributes(operation, model string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconvgenai.GenAIOperationNameKey.String(operation),
+		semconvgenai.GenAISystemKey.String(GenAISystem),
+		semconvgenai.GenAIRequestModel(model),
+	}
+}
+
+// GenAIResponseAttributes describes the response of the model backend. Empty
+// values are left out.
+func GenAIResponseAttributes(id, model string, finishReasons []string) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if id != "" {
+		attrs = append(attrs, semconvgenai.GenAIResponseID(id))
+	}
+	if model != "" {
+		attrs = append(attrs, semconvgenai.GenAIResponseModel(model))
+	}
+	if len(finishReasons) > 0 {
+		attrs = append(attrs, semconvgenai.GenAIResponseFinishReasons(finishReasons...))
+	}
+	return attrs
+}
+
+// GenAIUsageAttributes describes the tokens used by a request
+func GenAIUsageAttributes(inputTokens, outputTokens int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconvgenai.GenAIUsageInputTokens(inputTokens),
+		semconvgenai.GenAIUsageOutputTokens(outputTokens),
+	}
+}
@@ -19,12 +19,9 @@ type TracedModelInference struct {
 
 // NewTracedModelInference creates a new traced model inference
 func NewTracedModelInference(ctx context.Context, modelName string) *TracedModelInference {
-	// Start the parent span for the overall inference
-	ctx, span := StartSpan(ctx, "model_inference")
-	span.SetAttributes(
-		attribute.String("model.name", modelName),
-		attribute.String("inference.type", "streaming"),
-	)
+	// Start the parent span for the overall inference, named and described
+	// following the GenAI semantic conventions
+	ctx, span := StartGenAISpan(ctx, GenAIOperationChat, modelName)
 
 	return &TracedModelInference{
 		Ctx:        ctx,
@@ -55,38 +52,41 @@ func (t *TracedModelInference) RecordFirstToken(ttft time.Duration) {
 	}
 	
 	t.ParentSpan.AddEvent("first_token", trace.WithAttributes(
-		attribute.Float64("time_to_first_token_ms", float64(ttft.Milliseconds())),
+		attribute.Float64("time_to_first_token_ms", float64(ttft.Microseconds())/1000),
 	))
-	t.ParentSpan.SetAttributes(attribute.Float64("time_to_first_token_sec", ttft.Seconds()))
 }
 
-// RecordTokenCounts records the input and output token counts
-func (t *TracedModelInference) RecordTokenCounts(inputTokens, outputTokens int) {
+// RecordTokenCounts records the input and output token counts. estimated marks
+// counts the backend did not report.
+func (t *TracedModelInference) RecordTokenCounts(inputTokens, outputTokens int, estimated bool) {
 	if t.ParentSpan == nil {
 		return
 	}
 	
-	t.ParentSpan.SetAttributes(
-		attribute.Int("tokens.input", inputTokens),
-		attribute.Int("tokens.output", outputTokens),
-	)
+	t.ParentSpan.SetAttributes(GenAIUsageAttributes(inputTokens, outputTokens)...)
+	t.ParentSpan.SetAttributes(attribute.Bool(GenAIUsageEstimatedKey, estimated))
 }
 
-// End ends the parent span and records completion metrics
-func (t *TracedModelInference) End(outputTokens int, err error) {
+// RecordResponse records the response id, the model that answered and why generation stopped
+func (t *TracedModelInference) RecordResponse(id, model string, finishReasons []string) {
 	if t.ParentSpan == nil {
 		return
 	}
-	
-	totalDuration := time.Since(t.StartTime)
-	t.ParentSpan.SetAttributes(
-		attribute.Float64("duration_sec", totalDuration.Seconds()),
-		attribute.Int("tokens.output.total", outputTokens),
-	)
+
+	t.ParentSpan.SetAttributes(GenAIResponseAttributes(id, model, finishReasons)...)
+}
+
+// End ends the current phase and the parent span. Calling it again has no effect.
+func (t *TracedModelInference) End(err error) {
+	if t.ParentSpan == nil {
+		return
+	}
+	t.EndProcessing()
 	
 	if err != nil {
 		RecordError(t.Ctx, err, "Model inference error")
 	}
 	
 	t.ParentSpan.End()
+	t.ParentSpan = nil
 }
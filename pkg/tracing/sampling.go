@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	otelTrace "go.opentelemetry.io/otel/trace"
+)
+
+// maxPendingTraces bounds the traces held back while waiting for their root span.
+// Spans ending after their root start a new entry that is only released here.
+const maxPendingTraces = 1024
+
+// newSampler returns the head sampler for cfg. With tail sampling the traces
+// the head does not sample are still recorded, so the tailProcessor can keep
+// them when they fail or are slow.
+func newSampler(cfg Config) trace.Sampler {
+	head := trace.ParentBased(trace.TraceIDRatioBased(cfg.SampleRatio))
+	if cfg.tailSampling() {
+		return recordingSampler{head}
+	}
+	return head
+}
+
+// recordingSampler records the spans its head sampler drops. Only the sampled
+// traces carry the sampled flag, so exemplars, the X-Trace-Id header and the
+// propagated traceparent are limited to traces that are always exported.
+type recordingSampler struct {
+	head trace.Sampler
+}
+
+func (s recordingSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	result := s.head.ShouldSample(p)
+	if result.Decision == trace.Drop {
+		result.Decision = trace.RecordOnly
+	}
+	return result
+}
+
+func (s recordingSampler) Description() string {
+	return "RecordingSampler{" + s.head.Description() + "}"
+}
+
+// pendingTrace holds the finished spans of a trace whose root is still running
+type pendingTrace struct {
+	spans   []trace.ReadOnlySpan
+	failed  bool
+	started time.Time
+}
+
+// tailProcessor buffers the spans of each trace until its local root span ends,
+// then exports the whole trace if the head sampled it, it failed or was slow,
+// and drops it otherwise.
+type tailProcessor struct {
+	next       trace.SpanProcessor
+	keepErrors bool
+	slow       time.Duration
+
+	mu      sync.Mutex
+	pending map[otelTrace.TraceID]*pendingTrace
+}
+
+func newTailProcessor(next trace.SpanProcessor, cfg Config) *tailProcessor {
+	return &tailProcessor{
+		next:       next,
+		keepErrors: cfg.KeepErrors,
+		slow:       time.Duration(cfg.SlowThresholdMs) * time.Millisecond,
+		pending:    make(map[otelTrace.TraceID]*pendingTrace),
+	}
+}
+
+func (p *tailProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *tailProcessor) OnEnd(s trace.ReadOnlySpan) {
+	id := s.SpanContext().TraceID()
+	failed := s.Status().Code == codes.Error
+
+	p.mu.Lock()
+	pending, ok := p.pending[id]
+	if !ok {
+		pending = &pendingTrace{started: time.Now()}
+		p.pending[id] = pending
+	}
+	pending.spans = append(pending.spans, s)
+	pending.failed = pending.failed || failed
+
+	if s.Parent().IsValid() && !s.Parent().IsRemote() {
+		var evicted *pendingTrace
+		if len(p.pending) > maxPendingTraces {
+			evicted = p.evictOldest()
+		}
+		p.mu.Unlock()
+		if evicted != nil && p.keepErrors && evicted.failed {
+			p.export(evicted)
+		}
+		return
+	}
+	delete(p.pending, id)
+	p.mu.Unlock()
+
+	if p.keep(s, pending) {
+		p.export(pending)
+	}
+}
+
+// keep decides whether the trace rooted at root is exported
+func (p *tailProcessor) keep(root trace.ReadOnlySpan, pending *pendingTrace) bool {
+	if p.keepErrors && pending.failed {
+		return true
+	}
+	if p.slow > 0 && root.EndTime().Sub(root.StartTime()) >= p.slow {
+		return true
+	}
+	return root.SpanContext().IsSampled()
+}
+
+// evictOldest removes the trace that has waited longest, p.mu must be held
+func (p *tailProcessor) evictOldest() *pendingTrace {
+	var oldestID otelTrace.TraceID
+	var oldest *pendingTrace
+	for id, pending := range p.pending {
+		if oldest == nil || pending.started.Before(oldest.started) {
+			oldestID, oldest = id, pending
+		}
+	}
+	delete(p.pending, oldestID)
+	return oldest
+}
+
+func (p *tailProcessor) export(pending *pendingTrace) {
+	for _, s := range pending.spans {
+		if !s.SpanContext().IsSampled() {
+			s = keptSpan{s}
+		}
+		p.next.OnEnd(s)
+	}
+}
+
+// keptSpan marks a span the head did not sample as sampled, since span
+// processors and exporters drop unsampled spans
+type keptSpan struct {
+	trace.ReadOnlySpan
+}
+
+func (s keptSpan) SpanContext() otelTrace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+func (p *tailProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *tailProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestProvider(cfg Config) (*trace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := newTailProcessor(trace.NewSimpleSpanProcessor(exporter), cfg)
+	return trace.NewTracerProvider(trace.WithSampler(newSampler(cfg)), trace.WithSpanProcessor(processor)), exporter
+}
+
+// With tail sampling, traces the head does not sample are recorded but not
+// flagged as sampled, and only exported when they fail
+func TestTailSamplingFlagsOnlyHeadSampledTraces(t *testing.T) {
+	provider, exporter := newTestProvider(Config{SampleRatio: 0, KeepErrors: true})
+	tracer := provider.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "ok")
+	_, child := tracer.Start(ctx, "child")
+	if root.SpanContext().IsSampled() || !root.IsRecording() {
+		t.Fatalf("root span sampled=%v recording=%v, want unsampled and recording",
+			root.SpanContext().IsSampled(), root.IsRecording())
+	}
+	child.End()
+	root.End()
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("exported %d spans of a successful unsampled trace, want 0", len(spans))
+	}
+
+	ctx, root = tracer.Start(context.Background(), "failed")
+	_, child = tracer.Start(ctx, "child")
+	child.SetStatus(codes.Error, "failed")
+	child.End()
+	root.End()
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans of a failed trace, want 2", len(spans))
+	}
+	for _, s := range spans {
+		if !s.SpanContext.IsSampled() {
+			t.Errorf("exported span %q is not flagged as sampled", s.Name)
+		}
+	}
+}
+
+func TestTailSamplingKeepsHeadSampledTraces(t *testing.T) {
+	provider, exporter := newTestProvider(Config{SampleRatio: 1, KeepErrors: true})
+	tracer := provider.Tracer("test")
+
+	_, root := tracer.Start(context.Background(), "ok")
+	if !root.SpanContext().IsSampled() {
+		t.Fatal("root span is not sampled with a sample ratio of 1")
+	}
+	root.End()
+	if spans := exporter.GetSpans(); len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+}
@@ -4,62 +4,74 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	otelTrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
 )
 
-// SetupTracing initializes OpenTelemetry tracing
-func SetupTracing(serviceName string, otlpEndpoint string) (func(), error) {
-	// Create a resource with service information
-	res, err := resource.New(context.Background(),
+// NewResource describes the service to telemetry backends. Traces and metrics
+// use the same resource so they can be correlated.
+func NewResource(serviceName string) (*resource.Resource, error) {
+	return resource.New(context.Background(),
 		resource.WithAttributes(
 			semconv.ServiceNameKey.String(serviceName),
 		),
 	)
+}
+
+// SetupTracing initializes OpenTelemetry tracing with the sampler and exporter
+// described by cfg
+func SetupTracing(serviceName string, cfg Config) (func(), error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Create a resource with service information
+	res, err := NewResource(serviceName)
 	if err != nil {
 		return nil, err
 	}
 
-	var traceProvider *trace.TracerProvider
+	opts := []trace.TracerProviderOption{
+		trace.WithResource(res),
+		trace.WithSampler(newSampler(cfg)),
+	}
 
-	// If OTLP endpoint is provided, use it
-	if otlpEndpoint != "" {
-		client := otlptracehttp.NewClient(
-			otlptracehttp.WithEndpoint(otlpEndpoint),
-			otlptracehttp.WithInsecure(),
+	exporter, closeExporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		var processor trace.SpanProcessor = trace.NewBatchSpanProcessor(exporter,
+			trace.WithBatchTimeout(time.Duration(cfg.BatchTimeoutMs)*time.Millisecond),
 		)
-
-		exporter, err := otlptrace.New(context.Background(), client)
-		if err != nil {
-			return nil, err
+		if cfg.tailSampling() {
+			processor = newTailProcessor(processor, cfg)
 		}
-
-		traceProvider = trace.NewTracerProvider(
-			trace.WithResource(res),
-			trace.WithBatcher(exporter,
-				trace.WithBatchTimeout(5*time.Second),
-			),
-			trace.WithSampler(trace.AlwaysSample()), // Sample all traces for development
-		)
-	} else {
-		// Use a no-op exporter if no endpoint is provided
-		traceProvider = trace.NewTracerProvider(
-			trace.WithResource(res),
-			trace.WithSampler(trace.AlwaysSample()),
-		)
+		opts = append(opts, trace.WithSpanProcessor(processor))
 	}
 
-	// Set the global trace provider
+	traceProvider := trace.NewTracerProvider(opts...)
+
+	// Set the global trace provider and continue W3C trace context and baggage across services
 	otel.SetTracerProvider(traceProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 
 	// Return a cleanup function to flush and shutdown the tracer
 	return func() {
@@ -68,9 +80,71 @@ func SetupTracing(serviceName string, otlpEndpoint string) (func(), error) {
 		if err := traceProvider.Shutdown(ctx); err != nil {
 			log.Printf("Error shutting down tracer provider: %v", err)
 		}
+		closeExporter()
 	}, nil
 }
 
+// newExporter creates the span exporter selected by cfg. The returned function
+// releases resources the exporter does not own, such as the trace file. The
+// none exporter returns a nil exporter.
+func newExporter(cfg Config) (trace.SpanExporter, func(), error) {
+	noop := func() {}
+
+	switch cfg.Exporter {
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, noop, err
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, noop, err
+		}
+		return exporter, func() { f.Close() }, nil
+	case ExporterNone:
+		return nil, noop, nil
+	}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, noop, err
+	}
+
+	var client otlptrace.Client
+	if cfg.Protocol == ProtocolGRPC {
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(cfg.Headers))
+		}
+		switch {
+		case cfg.Insecure:
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		case tlsConfig != nil:
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		client = otlptracegrpc.NewClient(opts...)
+	} else {
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		switch {
+		case cfg.Insecure:
+			opts = append(opts, otlptracehttp.WithInsecure())
+		case tlsConfig != nil:
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		}
+		client = otlptracehttp.NewClient(opts...)
+	}
+
+	exporter, err := otlptrace.New(context.Background(), client)
+	return exporter, noop, err
+}
+
 // StartSpan starts a new span
 func StartSpan(ctx context.Context, spanName string) (context.Context, otelTrace.Span) {
 	tracer := otel.Tracer("genai-app")
@@ -155,4 +229,14 @@ func StartChildSpan(ctx context.Context, spanName string) (context.Context, otel
 	tracer := otel.Tracer("genai-app")
 	ctx, span := tracer.Start(ctx, spanName)
 	return ctx, span
-}
\ No newline at end of file
+}
+
+// RecordSpan records an already finished child span covering start to end
+func RecordSpan(ctx context.Context, spanName string, start, end time.Time, attrs ...attribute.KeyValue) {
+	tracer := otel.Tracer("genai-app")
+	_, span := tracer.Start(ctx, spanName,
+		otelTrace.WithTimestamp(start),
+		otelTrace.WithAttributes(attrs...),
+	)
+	span.End(otelTrace.WithTimestamp(end))
+}
@@ -0,0 +1,180 @@
+// Package upstream instruments the HTTP calls made to the model backend.
+package upstream
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// retryCountHeader is set by the OpenAI client on every attempt
+const retryCountHeader = "X-Stainless-Retry-Count"
+
+// Metrics holds the collectors the transport records into
+type Metrics struct {
+	// PhaseDuration is labelled by operation and phase (dns, connect, tls, ttfb)
+	PhaseDuration *prometheus.HistogramVec
+	// RequestDuration is labelled by operation and covers the call until the body is closed
+	RequestDuration *prometheus.HistogramVec
+	// Requests is labelled by operation and status code
+	Requests *prometheus.CounterVec
+	// Retries is labelled by operation
+	Retries *prometheus.CounterVec
+}
+
+// Transport is an http.RoundTripper recording timings, status codes and retries
+// of upstream calls as metrics and child spans of the request trace
+type Transport struct {
+	base    http.RoundTripper
+	metrics Metrics
+}
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil
+func NewTransport(base http.RoundTripper, metrics Metrics) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base, metrics: metrics}
+}
+
+// NewClient returns an http.Client using an instrumented transport
+func NewClient(metrics Metrics) *http.Client {
+	return &http.Client{Transport: NewTransport(nil, metrics)}
+}
+
+// Operation maps a backend API path to a low-cardinality operation label
+func Operation(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return "chat"
+	case strings.HasSuffix(path, "/completions"):
+		return "completions"
+	case strings.HasSuffix(path, "/embeddings"):
+		return "embeddings"
+	case strings.HasSuffix(path, "/models"):
+		return "models"
+	default:
+		return "other"
+	}
+}
+
+// phaseTimer collects httptrace callbacks, which may run on different goroutines
+type phaseTimer struct {
+	mu     sync.Mutex
+	starts map[string]time.Time
+}
+
+func (p *phaseTimer) start(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts[phase] = time.Now()
+}
+
+func (p *phaseTimer) done(phase string) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start, ok := p.starts[phase]
+	delete(p.starts, phase)
+	return start, ok
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := Operation(req.URL.Path)
+
+	ctx, span := tracing.StartSpan(req.Context(), "upstream_"+op)
+	span.SetAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("http.url", req.URL.String()),
+		attribute.String("upstream.operation", op),
+	)
+
+	if retry, err := strconv.Atoi(req.Header.Get(retryCountHeader)); err == nil && retry > 0 {
+		t.metrics.Retries.WithLabelValues(op).Inc()
+		span.SetAttributes(attribute.Int("http.retry_count", retry))
+	}
+
+	start := time.Now()
+	timer := &phaseTimer{starts: make(map[string]time.Time)}
+	observe := func(phase string, end time.Time) {
+		phaseStart, ok := timer.done(phase)
+		if !ok {
+			return
+		}
+		t.metrics.PhaseDuration.WithLabelValues(op, phase).Observe(end.Sub(phaseStart).Seconds())
+		tracing.RecordSpan(ctx, "upstream_"+phase, phaseStart, end)
+	}
+
+	// ttfb runs from the end of the request write to the first response byte, so
+	// it does not repeat the dns, connect and tls phases
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { timer.start("dns") },
+		DNSDone:           func(httptrace.DNSDoneInfo) { observe("dns", time.Now()) },
+		ConnectStart:      func(string, string) { timer.start("connect") },
+		ConnectDone:       func(string, string, error) { observe("connect", time.Now()) },
+		TLSHandshakeStart: func() { timer.start("tls") },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { observe("tls", time.Now()) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.SetAttributes(attribute.Bool("http.conn_reused", info.Reused))
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { timer.start("ttfb") },
+		GotFirstResponseByte: func() { observe("ttfb", time.Now()) },
+	}
+
+	// Continue the request trace in the model backend
+	req = req.Clone(httptrace.WithClientTrace(ctx, trace))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.metrics.Requests.WithLabelValues(op, "error").Inc()
+		t.metrics.RequestDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Upstream request failed")
+		span.End()
+		return nil, err
+	}
+
+	t.metrics.Requests.WithLabelValues(op, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	// Streaming responses are still being read, so the span ends when the body is closed
+	resp.Body = &instrumentedBody{
+		ReadCloser: resp.Body,
+		done: func() {
+			t.metrics.RequestDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+			span.End()
+		},
+	}
+	return resp, nil
+}
+
+// instrumentedBody calls done once when the response body is closed
+type instrumentedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+// Close closes the wrapped body and finishes the measurement
+func (b *instrumentedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
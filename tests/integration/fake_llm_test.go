@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/fakellm"
+)
+
+// TestMain starts the backend against the in-repo fake LLM when USE_FAKE_LLM=true,
+// so the chat tests run without Docker or a real model
+func TestMain(m *testing.M) {
+	if os.Getenv("USE_FAKE_LLM") != "true" {
+		os.Exit(m.Run())
+	}
+
+	stop, err := startFakeLLMBackend()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start backend with fake LLM: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// startFakeLLMBackend builds and starts the backend pointed at an httptest fake LLM
+// and exports its URL as BASE_URL for setupTestEnvironment
+func startFakeLLMBackend() (func(), error) {
+	cfg := fakellm.DefaultConfig()
+	cfg.Rules = []fakellm.Rule{
+		{Match: "2 + 2", Response: "2 + 2 equals 4."},
+		{Match: "Docker", Response: "Docker packages applications into portable containers."},
+	}
+	fake := httptest.NewServer(fakellm.New(cfg))
+
+	binDir, err := os.MkdirTemp("", "genai-app-test")
+	if err != nil {
+		fake.Close()
+		return nil, err
+	}
+	binary := filepath.Join(binDir, "genai-app")
+
+	build := exec.Command("go", "build", "-o", binary, "../..")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fake.Close()
+		os.RemoveAll(binDir)
+		return nil, fmt.Errorf("failed to build backend: %w", err)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		fake.Close()
+		os.RemoveAll(binDir)
+		return nil, err
+	}
+	metricsPort, err := freePort()
+	if err != nil {
+		fake.Close()
+		os.RemoveAll(binDir)
+		return nil, err
+	}
+
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(),
+		"BASE_URL="+fake.URL+"/v1/",
+		"MODEL="+cfg.Model,
+		"API_KEY=fake",
+		"TRACING_ENABLED=false",
+		fmt.Sprintf("PORT=%d", port),
+		fmt.Sprintf("METRICS_PORT=%d", metricsPort),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fake.Close()
+		os.RemoveAll(binDir)
+		return nil, fmt.Errorf("failed to start backend: %w", err)
+	}
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		fake.Close()
+		os.RemoveAll(binDir)
+	}
+
+	backendURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	if err := waitForHealthy(backendURL, 10*time.Second); err != nil {
+		stop()
+		return nil, err
+	}
+
+	os.Setenv("BASE_URL", backendURL)
+	return stop, nil
+}
+
+// freePort asks the kernel for an unused TCP port
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForHealthy polls the health endpoint until it answers or the timeout expires
+func waitForHealthy(baseURL string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(baseURL + "/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("backend at %s not healthy after %s", baseURL, timeout)
+}
+
+// TestChatMetricsWithFakeLLM checks that a chat through the fake backend is reflected in the Prometheus metrics
+func TestChatMetricsWithFakeLLM(t *testing.T) {
+	if os.Getenv("USE_FAKE_LLM") != "true" {
+		t.Skip("set USE_FAKE_LLM=true to run against the fake LLM")
+	}
+
+	baseURL, err := setupTestEnvironment()
+	if err != nil {
+		t.Fatalf("Failed to setup test environment: %v", err)
+	}
+
+	response := sendChatRequest(t, baseURL, ChatRequest{
+		Messages: []Message{{Role: "user", Content: "What is Docker?"}},
+	})
+	if !strings.Contains(response, "containers") {
+		t.Errorf("Unexpected response from fake LLM: %q", response)
+	}
+
+	resp, err := http.Get(baseURL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+
+	for _, name := range []string{
+		"genai_app_chat_tokens_total",
+		"genai_app_first_token_latency_seconds_count",
+		"genai_app_model_latency_seconds_count",
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("Expected metric %s after a chat request", name)
+		}
+	}
+}